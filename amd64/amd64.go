@@ -0,0 +1,299 @@
+package amd64
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/toolchain"
+)
+
+// Generator translates IR into x86-64 assembly for the GNU assembler
+// (AT&T syntax, ELF, System V ABI).
+//
+// Every variable and every register of a function has an 8-byte slot in its
+// frame and instructions go through %rax, %rcx and %rdx. Arguments of bee
+// functions are pushed on the stack from right to left and removed by the
+// caller, so the first argument is at 16(%rbp). The functions of the runtime
+// follow the System V calling convention.
+type Generator struct {
+	program *ir.Program
+	out     bytes.Buffer
+
+	// the state of the function being generated
+	index     int
+	variables map[*ast.Variable]int
+	registers map[*ir.Register]int
+}
+
+// New returns a new generator for program
+func New(program *ir.Program) *Generator {
+	return &Generator{program: program}
+}
+
+// Generate generates the assembly of the whole program
+func (g *Generator) Generate() string {
+	g.out.Reset()
+
+	g.emit(".text")
+	for i, function := range g.program.Functions {
+		g.index = i
+		g.generateFunction(function)
+	}
+	g.emit(`.section .note.GNU-stack,"",@progbits`)
+
+	return g.out.String()
+}
+
+func (g *Generator) generateFunction(function *ir.Function) {
+	g.variables = make(map[*ast.Variable]int)
+	g.registers = make(map[*ir.Register]int)
+
+	slots := 0
+	for _, variable := range function.Node.Variables {
+		slots++
+		g.variables[variable] = -8 * slots
+	}
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			rs := ir.Uses(instr)
+			if r := ir.Def(instr); r != nil {
+				rs = append(rs, r)
+			}
+			for _, r := range rs {
+				if _, ok := g.registers[r]; !ok {
+					slots++
+					g.registers[r] = -8 * slots
+				}
+			}
+		}
+	}
+
+	// keep %rsp aligned to 16 bytes for calls
+	size := (8*slots + 15) / 16 * 16
+
+	symbol := toolchain.Symbol(function.Node.Name)
+	g.emit("")
+	g.emit(".globl %s", symbol)
+	g.emit(".type %s, @function", symbol)
+	g.label(symbol)
+	g.emit("  pushq %%rbp")
+	g.emit("  movq %%rsp, %%rbp")
+	if size > 0 {
+		g.emit("  subq $%d, %%rsp", size)
+	}
+
+	// variables start from zero
+	for _, variable := range function.Node.Variables {
+		g.emit("  movq $0, %d(%%rbp)", g.variables[variable])
+	}
+
+	for i, bb := range function.BasicBlocks {
+		var next *ir.BasicBlock
+		if i+1 < len(function.BasicBlocks) {
+			next = function.BasicBlocks[i+1]
+		}
+
+		g.label(g.blockLabel(bb))
+		for _, instr := range bb.Irs {
+			g.generateInstruction(instr, next)
+		}
+	}
+
+	// falling off the end returns 0 like in the VM
+	g.emit("  xorl %%eax, %%eax")
+	g.emit("  leave")
+	g.emit("  ret")
+	g.emit(".size %s, .-%s", symbol, symbol)
+}
+
+func (g *Generator) generateInstruction(instr ir.Ir, next *ir.BasicBlock) {
+	switch instr := instr.(type) {
+	case *ir.ImmIr:
+		if instr.Value == int64(int32(instr.Value)) {
+			g.emit("  movq $%d, %s", instr.Value, g.slot(instr.R))
+		} else {
+			g.emit("  movabsq $%d, %%rax", instr.Value)
+			g.store("%rax", instr.R)
+		}
+	case *ir.MovIr:
+		g.load("%rax", instr.R1)
+		g.store("%rax", instr.R0)
+	case *ir.BinaryOpIr:
+		g.load("%rax", instr.R1)
+		g.load("%rcx", instr.R2)
+		g.binary(instr.Operator)
+		g.store("%rax", instr.R0)
+	case *ir.UnaryOpIr:
+		g.load("%rax", instr.R1)
+		switch instr.Operator {
+		case "!":
+			g.emit("  testq %%rax, %%rax")
+			g.emit("  sete %%al")
+			g.emit("  movzbq %%al, %%rax")
+		case "~":
+			g.emit("  notq %%rax")
+		}
+		g.store("%rax", instr.R0)
+	case *ir.BprelIr:
+		g.emit("  leaq %d(%%rbp), %%rax", g.variables[instr.Var])
+		g.store("%rax", instr.R)
+	case *ir.LoadIr:
+		g.load("%rax", instr.R1)
+		g.emit("  movq (%%rax), %%rax")
+		g.store("%rax", instr.R0)
+	case *ir.StoreIr:
+		g.load("%rax", instr.R0)
+		g.load("%rcx", instr.R1)
+		g.emit("  movq %%rcx, (%%rax)")
+	case *ir.StoreArgIr:
+		g.emit("  movq %d(%%rbp), %%rax", 16+8*instr.Index)
+		g.emit("  movq %%rax, %d(%%rbp)", g.variables[instr.Var])
+	case *ir.CallIr:
+		// an odd number of arguments is padded to keep %rsp aligned
+		size := 8 * len(instr.Arguments)
+		if len(instr.Arguments)%2 == 1 {
+			g.emit("  subq $8, %%rsp")
+			size += 8
+		}
+		for i := len(instr.Arguments) - 1; i >= 0; i-- {
+			g.emit("  pushq %s", g.slot(instr.Arguments[i]))
+		}
+		g.emit("  call %s", toolchain.Symbol(instr.Function))
+		if size > 0 {
+			g.emit("  addq $%d, %%rsp", size)
+		}
+		g.store("%rax", instr.Return)
+	case *ir.ArgcIr:
+		g.emit("  call bee_argc")
+		g.store("%rax", instr.R)
+	case *ir.ArgIr:
+		g.load("%rdi", instr.R1)
+		g.emit("  call bee_arg")
+		g.store("%rax", instr.R0)
+	case *ir.GetsIr:
+		g.emit("  call bee_gets")
+		g.store("%rax", instr.R)
+	case *ir.EofIr:
+		g.emit("  call bee_eof")
+		g.store("%rax", instr.R)
+	case *ir.PutsIr:
+		g.load("%rdi", instr.R)
+		g.emit("  call bee_puts")
+	case *ir.JmpIr:
+		if instr.Target != next {
+			g.emit("  jmp %s", g.blockLabel(instr.Target))
+		}
+	case *ir.BrIr:
+		g.load("%rax", instr.R)
+		g.emit("  testq %%rax, %%rax")
+		g.emit("  jne %s", g.blockLabel(instr.Consequence))
+		if instr.Alternative != next {
+			g.emit("  jmp %s", g.blockLabel(instr.Alternative))
+		}
+	case *ir.RetIr:
+		g.load("%rax", instr.R)
+		g.emit("  leave")
+		g.emit("  ret")
+	case *ir.NopIr:
+	}
+}
+
+// binary computes `%rax op %rcx` into %rax
+func (g *Generator) binary(op string) {
+	switch op {
+	case "+":
+		g.emit("  addq %%rcx, %%rax")
+	case "-":
+		g.emit("  subq %%rcx, %%rax")
+	case "*":
+		g.emit("  imulq %%rcx, %%rax")
+	case "&":
+		g.emit("  andq %%rcx, %%rax")
+	case "|":
+		g.emit("  orq %%rcx, %%rax")
+	case "^":
+		g.emit("  xorq %%rcx, %%rax")
+	case "<<":
+		// the count is masked to 6 bits by the CPU like in ir.EvalBinary
+		g.emit("  salq %%cl, %%rax")
+	case ">>":
+		g.emit("  sarq %%cl, %%rax")
+	case "==":
+		g.compare("sete")
+	case "<":
+		g.compare("setl")
+	case "&&":
+		g.emit("  testq %%rax, %%rax")
+		g.emit("  setne %%al")
+		g.emit("  testq %%rcx, %%rcx")
+		g.emit("  setne %%cl")
+		g.emit("  andb %%cl, %%al")
+		g.emit("  movzbq %%al, %%rax")
+	case "||":
+		g.emit("  orq %%rcx, %%rax")
+		g.emit("  setne %%al")
+		g.emit("  movzbq %%al, %%rax")
+	case "/", "%":
+		g.divide(op)
+	}
+}
+
+func (g *Generator) compare(set string) {
+	g.emit("  cmpq %%rcx, %%rax")
+	g.emit("  %s %%al", set)
+	g.emit("  movzbq %%al, %%rax")
+}
+
+// divide divides %rax by %rcx. idiv traps on division by zero and on
+// overflow, so a zero divisor is reported by the runtime and -1 is handled
+// separately to wrap around like ir.EvalBinary.
+func (g *Generator) divide(op string) {
+	g.emit("  testq %%rcx, %%rcx")
+	g.emit("  jne 1f")
+	g.emit("  call bee_division_by_zero")
+	g.emit("1:")
+	g.emit("  cmpq $-1, %%rcx")
+	g.emit("  jne 2f")
+	if op == "/" {
+		g.emit("  negq %%rax")
+	} else {
+		g.emit("  xorl %%eax, %%eax")
+	}
+	g.emit("  jmp 3f")
+	g.emit("2:")
+	g.emit("  cqto")
+	g.emit("  idivq %%rcx")
+	if op == "%" {
+		g.emit("  movq %%rdx, %%rax")
+	}
+	g.emit("3:")
+}
+
+func (g *Generator) slot(r *ir.Register) string {
+	return fmt.Sprintf("%d(%%rbp)", g.registers[r])
+}
+
+func (g *Generator) load(to string, r *ir.Register) {
+	g.emit("  movq %s, %s", g.slot(r), to)
+}
+
+func (g *Generator) store(from string, r *ir.Register) {
+	g.emit("  movq %s, %s", from, g.slot(r))
+}
+
+// blockLabel returns the label of bb, which is unique in the program even
+// if labels of IR are only unique in each function
+func (g *Generator) blockLabel(bb *ir.BasicBlock) string {
+	return fmt.Sprintf(".L%d.%d", g.index, bb.Label)
+}
+
+func (g *Generator) label(name string) {
+	g.emit("%s:", name)
+}
+
+func (g *Generator) emit(format string, a ...interface{}) {
+	g.out.WriteString(fmt.Sprintf(format, a...))
+	g.out.WriteString("\n")
+}
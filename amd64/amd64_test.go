@@ -0,0 +1,141 @@
+package amd64
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/toolchain"
+)
+
+func TestGenerate(t *testing.T) {
+	program, err := ir.Parse("[main]\n.L0:\n  IMM r0, 4294967296\n  IMM r1, 2\n  r2 = r0 / r1\n  RET r2\n")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	asm := New(program).Generate()
+
+	expected := []string{
+		".globl bee_main\n",
+		"bee_main:\n  pushq %rbp\n  movq %rsp, %rbp\n  subq $32, %rsp\n",
+		"  movabsq $4294967296, %rax\n  movq %rax, -8(%rbp)\n",
+		"  movq $2, -16(%rbp)\n",
+		"  call bee_division_by_zero\n",
+		"  cqto\n  idivq %rcx\n",
+		"  movq -24(%rbp), %rax\n  leave\n  ret\n",
+	}
+	for i, e := range expected {
+		if !strings.Contains(asm, e) {
+			t.Errorf("[test-%d] %q is missing in\n%s", i, e, asm)
+		}
+	}
+}
+
+// TestExecutables compares native executables with the VM
+func TestExecutables(t *testing.T) {
+	tc := toolchain.Default()
+	for _, tool := range []string{tc.Assembler, tc.Compiler} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+
+	tests := []testutil.Case{
+		{Input: "fn main() { return 42; }"},
+		{Input: "fn main() { puts 1 + 2 * 3; x = 7; y = 3; puts x / y; puts 0 - x / y; puts 0 - x % y; }"},
+		{Input: "fn main() { x = 7; y = 3; puts x & y; puts x | 8; puts x ^ y; puts ~x; puts x << y; puts 0 - x >> 1; puts !x; puts x == y; puts y < x; puts x && 0; puts 0 || y; }"},
+		{Input: "fn main() { x = 9223372036854775807; puts x + 1; y = 0 - 1; puts (x + 1) / y; puts (x + 1) % y; puts 1 << 65; }"},
+		{Input: "fn main() { i = 0; s = 0; while (i < 10) { s += i; i++; } return s; }"},
+		{Input: "fn main() { return fact(10) % 256; } fn fact(n) { if (n < 2) { return 1; } return n * fact(n - 1); }"},
+		{Input: "fn main() { return f(1, 2, 3) + g(4, 5); } fn f(a, b, c) { return a * 100 + b * 10 + c; } fn g(a, b) { return a - b; }"},
+		{Input: "fn main() { puts argc(); puts arg(0) + arg(1); }", Args: []string{"40", "0x2"}},
+		{Input: "fn main() { s = 0; x = gets(); while (!eof()) { s = s + x; x = gets(); } return s; }", Stdin: "1 2\n 3\n"},
+		// integers are read like strconv.ParseInt(s, 0, 64)
+		{Input: "fn main() { i = 0; while (i < argc()) { puts arg(i); i++; } puts gets(); puts gets(); }",
+			Args: []string{"0b101", "1_000", "0o17", "017", "-0x_1F", "+9223372036854775807", "-9223372036854775808"}, Stdin: "0B11 0o7_7\n"},
+		{Input: "fn main() { return count(100000, 0); } fn count(n, acc) { if (n == 0) { return acc % 256; } return count(n - 1, acc + 1); }"},
+	}
+
+	dir, err := ioutil.TempDir("", "bee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testutil.CompareExecutables(t, tests, func(t *testing.T, program *ir.Program, args []string, stdin string) (string, int64, error) {
+		return testutil.RunExecutable(t, link(t, dir, tc, program), args, stdin)
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tc := toolchain.Default()
+	for _, tool := range []string{tc.Assembler, tc.Compiler} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+
+	tests := []struct {
+		input string
+		args  []string
+		stdin string
+		err   string
+	}{
+		{"fn main() { x = 0; return 1 / x; }", nil, "", "Error: division by zero\n"},
+		{"fn main() { return arg(1); }", []string{"1"}, "", "Error: argument index 1 out of range\n"},
+		{"fn main() { return arg(0); }", []string{"a"}, "", "Error: argument 0 (\"a\") is not an integer\n"},
+		{"fn main() { return gets(); }", nil, "x", "Error: input \"x\" is not an integer\n"},
+		{"fn main() { return arg(0); }", []string{" 7"}, "", "Error: argument 0 (\" 7\") is not an integer\n"},
+		{"fn main() { return arg(0); }", []string{"1__0"}, "", "Error: argument 0 (\"1__0\") is not an integer\n"},
+		{"fn main() { return arg(0); }", []string{"9223372036854775808"}, "", "Error: argument 0 (\"9223372036854775808\") is not an integer\n"},
+		{"fn main() { return gets(); }", nil, "0x", "Error: input \"0x\" is not an integer\n"},
+	}
+
+	dir, err := ioutil.TempDir("", "bee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tt := range tests {
+		executable := link(t, dir, tc, testutil.Compile(t, tt.input, 1))
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(executable, tt.args...)
+		cmd.Stdin = strings.NewReader(tt.stdin)
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Errorf("[test-%d] expected exit status 1, got %v", i, err)
+		}
+		if stderr.String() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, stderr.String())
+		}
+	}
+}
+
+func link(t *testing.T, dir string, tc toolchain.Toolchain, program *ir.Program) string {
+	source := filepath.Join(dir, "program.s")
+	object := filepath.Join(dir, "program.o")
+	executable := filepath.Join(dir, "program")
+
+	if err := ioutil.WriteFile(source, []byte(New(program).Generate()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Assemble(source, object); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Link(executable, object); err != nil {
+		t.Fatal(err)
+	}
+
+	return executable
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/d2verb/bee/token"
 )
 
 // Node defines an interface for all nodes in the AST
@@ -27,6 +30,7 @@ type Expression interface {
 // Program is a root node and consist of a slice of Function(s)
 type Program struct {
 	Functions []*Function
+	Comments  []token.Comment // all comments in the source order
 }
 
 // String returns a stringified version of the AST for debugging
@@ -48,6 +52,7 @@ type Variable struct {
 
 // Function is a top level node and represents a function
 type Function struct {
+	Pos        token.Position
 	Name       string
 	Parameters []*Variable
 	Variables  []*Variable
@@ -76,6 +81,7 @@ func (fn *Function) String() string {
 
 // Identifier represents an identifier and holds the name of the identifier
 type Identifier struct {
+	Pos  token.Position
 	Name string
 	Var  *Variable
 }
@@ -87,6 +93,8 @@ func (id *Identifier) String() string { return id.Name }
 
 // ExpressionStatement represents an expression statement and holds an expression
 type ExpressionStatement struct {
+	Pos        token.Position
+	End        token.Position // position of the last token, usually `;`
 	Expression Expression
 }
 
@@ -99,7 +107,9 @@ func (es *ExpressionStatement) String() string {
 
 // IntegerLiteral represents al literal integer and holds an integer value
 type IntegerLiteral struct {
-	Value int64
+	Pos     token.Position
+	Literal string // as written in the source, e.g: 0xff
+	Value   int64
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -109,10 +119,47 @@ func (il *IntegerLiteral) String() string {
 	return strconv.FormatInt(il.Value, 10)
 }
 
+// CharLiteral represents a character literal and holds its code point
+// e.g: 'a'
+type CharLiteral struct {
+	Pos     token.Position
+	Literal string // as written in the source, e.g: '\x41'
+	Value   rune
+}
+
+func (cl *CharLiteral) expressionNode() {}
+
+// String returns a stringified version of the AST for debugging
+func (cl *CharLiteral) String() string {
+	switch cl.Value {
+	case '\n':
+		return `'\n'`
+	case '\t':
+		return `'\t'`
+	case '\r':
+		return `'\r'`
+	case 0:
+		return `'\0'`
+	case '\\':
+		return `'\\'`
+	case '\'':
+		return `'\''`
+	}
+
+	if unicode.IsPrint(cl.Value) {
+		return fmt.Sprintf("'%c'", cl.Value)
+	}
+	if cl.Value < 0x80 {
+		return fmt.Sprintf("'\\x%02x'", cl.Value)
+	}
+	return fmt.Sprintf("'\\u{%x}'", cl.Value)
+}
+
 // PrefixExpression represents a prefix expression and holds the operator
 // as well as the right-hand side expression
 // e.g: !is_valid
 type PrefixExpression struct {
+	Pos      token.Position
 	Operator string
 	Right    Expression
 }
@@ -128,6 +175,7 @@ func (pe *PrefixExpression) String() string {
 // expression, operator and right-hand expression
 // e.g.: 1 + 2
 type InfixExpression struct {
+	Pos      token.Position // position of the operator
 	Left     Expression
 	Operator string
 	Right    Expression
@@ -143,6 +191,7 @@ func (ie *InfixExpression) String() string {
 // CallExpression represents a call expression and holds the function to be
 // called as well as the arguments to be passed to that function
 type CallExpression struct {
+	Pos       token.Position
 	Function  string
 	Arguments []Expression
 }
@@ -169,6 +218,8 @@ func (ce *CallExpression) String() string {
 // BlockStatement represents a block statement and holds one or more other
 // statements
 type BlockStatement struct {
+	Pos        token.Position // position of `{`
+	End        token.Position // position of `}`
 	Statements []Statement
 }
 
@@ -190,6 +241,8 @@ func (bs *BlockStatement) String() string {
 // ReturnStatement represenets the `return` statement node
 // e.g: return 1234;
 type ReturnStatement struct {
+	Pos   token.Position
+	End   token.Position // position of the last token, usually `;`
 	Value Expression
 }
 
@@ -203,6 +256,7 @@ func (rs *ReturnStatement) String() string {
 // IfStatement represents an `if` statement and holds the condition,
 // consequence and alternative expressions
 type IfStatement struct {
+	Pos         token.Position
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative *BlockStatement
@@ -230,6 +284,7 @@ func (is *IfStatement) String() string {
 // WhileStatement represents an `while` statement and holds the condition,
 // and consequence expression
 type WhileStatement struct {
+	Pos       token.Position
 	Condition Expression
 	Body      *BlockStatement
 }
@@ -248,9 +303,46 @@ func (we *WhileStatement) String() string {
 	return out.String()
 }
 
+// CompoundAssignStatement represents a compound assignment and holds the
+// target, the operator and the right-hand side expression
+// e.g: x += 1;
+type CompoundAssignStatement struct {
+	Pos      token.Position
+	End      token.Position // position of the last token, usually `;`
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (cs *CompoundAssignStatement) statementNode() {}
+
+// String returns a stringified version of the AST for debugging
+func (cs *CompoundAssignStatement) String() string {
+	return fmt.Sprintf("%s%s%s;", cs.Target.String(), cs.Operator, cs.Value.String())
+}
+
+// IncDecStatement represents an increment or decrement statement and holds
+// the target and the operator
+// e.g: x++;
+type IncDecStatement struct {
+	Pos      token.Position
+	End      token.Position // position of the last token, usually `;`
+	Target   Expression
+	Operator string
+}
+
+func (is *IncDecStatement) statementNode() {}
+
+// String returns a stringified version of the AST for debugging
+func (is *IncDecStatement) String() string {
+	return fmt.Sprintf("%s%s;", is.Target.String(), is.Operator)
+}
+
 // PutsStatement represents an `puts` statement and holds the argument
 // e.g: puts(1234);
 type PutsStatement struct {
+	Pos   token.Position
+	End   token.Position // position of the last token, usually `;`
 	Value Expression
 }
 
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/d2verb/bee/amd64"
+	"github.com/d2verb/bee/bytecode"
+	"github.com/d2verb/bee/cgen"
+	"github.com/d2verb/bee/toolchain"
+	"github.com/d2verb/bee/wat"
+)
+
+// buildUsage is also printed by `bee` without arguments
+const buildUsage = "bee build [-o output] [-S|-c|-emit-ir|-emit-c|-emit-wat|-emit-bytecode] [-backend amd64|c] [-as assembler] [-cc compiler] [optimizer flags] <file>"
+
+// buildCommand implements `bee build` and returns the exit status. With the
+// amd64 backend the program is compiled to x86-64 assembly, assembled with
+// the assembler and linked with the runtime by the C compiler. With the c
+// backend it is compiled to C, which includes the runtime, and built by the
+// C compiler. -S, -c, -emit-ir, -emit-c, -emit-wat and -emit-bytecode stop
+// after writing the assembly, the object file, the optimized IR, the C
+// source, the WebAssembly text or the .beec file for `bee exec`
+// respectively.
+func buildCommand(args []string) int {
+	defaults := toolchain.Default()
+
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "write the output to the file, or to stdout if it is - for -S and the -emit flags (default: the input name with the extension of the output)")
+	emitAssembly := flags.Bool("S", false, "stop after writing the assembly")
+	emitObject := flags.Bool("c", false, "stop after writing the object file")
+	emitIR := flags.Bool("emit-ir", false, "stop after writing the optimized IR")
+	emitC := flags.Bool("emit-c", false, "stop after writing the C source")
+	emitWAT := flags.Bool("emit-wat", false, "stop after writing the WebAssembly text")
+	emitBytecode := flags.Bool("emit-bytecode", false, "stop after writing the bytecode for bee exec")
+	backend := flags.String("backend", "amd64", "the code generator, amd64 or c")
+	assembler := flags.String("as", defaults.Assembler, "the assembler, which defaults to $AS if set")
+	compiler := flags.String("cc", defaults.Compiler, "the C compiler to build the runtime and link, which defaults to $CC if set")
+	options := optimizerFlags(flags)
+	flags.Parse(args)
+
+	stops := 0
+	for _, stop := range []bool{*emitAssembly, *emitObject, *emitIR, *emitC, *emitWAT, *emitBytecode} {
+		if stop {
+			stops++
+		}
+	}
+	if flags.NArg() != 1 || stops > 1 {
+		fmt.Println("USAGE: " + buildUsage)
+		return 1
+	}
+	if *backend != "amd64" && *backend != "c" {
+		fmt.Printf("bee build: unknown backend %q\n", *backend)
+		return 1
+	}
+	if *emitAssembly && *backend != "amd64" {
+		fmt.Println("bee build: -S requires the amd64 backend")
+		return 1
+	}
+
+	filename := flags.Arg(0)
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	executable := base
+	if executable == filename {
+		executable = "a.out"
+	}
+
+	tc := toolchain.Toolchain{Assembler: *assembler, Compiler: *compiler}
+
+	irProgram := compile(filename, *options)
+
+	switch {
+	case *emitIR:
+		return writeOutput(outputName(*output, base+".ir"), irProgram.String())
+	case *emitC:
+		return writeOutput(outputName(*output, base+".c"), cgen.New(irProgram).Generate())
+	case *emitWAT:
+		module, err := wat.New(irProgram).Generate()
+		if err != nil {
+			fmt.Printf("bee build: %s\n", err)
+			return 1
+		}
+		return writeOutput(outputName(*output, base+".wat"), module)
+	case *emitBytecode:
+		program, err := bytecode.Compile(irProgram)
+		if err != nil {
+			fmt.Printf("bee build: %s\n", err)
+			return 1
+		}
+		var buf bytes.Buffer
+		if err := bytecode.Encode(&buf, program); err != nil {
+			fmt.Println("Error: ", err)
+			return 1
+		}
+		return writeOutput(outputName(*output, base+".beec"), buf.String())
+	case *emitAssembly:
+		return writeOutput(outputName(*output, base+".s"), amd64.New(irProgram).Generate())
+	}
+
+	dir, err := ioutil.TempDir("", "bee")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	if *backend == "c" {
+		source := filepath.Join(dir, filepath.Base(base)+".c")
+		if err := ioutil.WriteFile(source, []byte(cgen.New(irProgram).Generate()), 0644); err != nil {
+			fmt.Println("Error: ", err)
+			return 1
+		}
+
+		if *emitObject {
+			err = tc.CompileObject(source, outputName(*output, base+".o"))
+		} else {
+			err = tc.Compile(outputName(*output, executable), source)
+		}
+		if err != nil {
+			fmt.Printf("bee build: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	source := filepath.Join(dir, filepath.Base(base)+".s")
+	if err := ioutil.WriteFile(source, []byte(amd64.New(irProgram).Generate()), 0644); err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+
+	object := filepath.Join(dir, filepath.Base(base)+".o")
+	if *emitObject {
+		object = outputName(*output, base+".o")
+	}
+	if err := tc.Assemble(source, object); err != nil {
+		fmt.Printf("bee build: %s\n", err)
+		return 1
+	}
+	if *emitObject {
+		return 0
+	}
+
+	if err := tc.Link(outputName(*output, executable), object); err != nil {
+		fmt.Printf("bee build: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func outputName(output string, fallback string) string {
+	if output != "" {
+		return output
+	}
+	return fallback
+}
+
+// writeOutput writes content to the file, or to stdout if filename is "-"
+func writeOutput(filename string, content string) int {
+	if filename == "-" {
+		fmt.Print(content)
+		return 0
+	}
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,264 @@
+package bytecode
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Opcode represents the operation of an instruction
+type Opcode uint8
+
+// Opcodes. R[x] is the register x of the current frame, K[x] is the constant
+// x of the program and jump offsets are relative to the next instruction.
+const (
+	OpLoadK    Opcode = iota // R[A] = K[B]
+	OpMove                   // R[A] = R[B]
+	OpAdd                    // R[A] = R[B] + R[C]
+	OpSub                    // R[A] = R[B] - R[C]
+	OpMul                    // R[A] = R[B] * R[C]
+	OpDiv                    // R[A] = R[B] / R[C]
+	OpMod                    // R[A] = R[B] % R[C]
+	OpAnd                    // R[A] = R[B] & R[C]
+	OpOr                     // R[A] = R[B] | R[C]
+	OpXor                    // R[A] = R[B] ^ R[C]
+	OpShl                    // R[A] = R[B] << R[C]
+	OpShr                    // R[A] = R[B] >> R[C]
+	OpEq                     // R[A] = R[B] == R[C]
+	OpLt                     // R[A] = R[B] < R[C]
+	OpLogAnd                 // R[A] = R[B] && R[C]
+	OpLogOr                  // R[A] = R[B] || R[C]
+	OpNot                    // R[A] = !R[B]
+	OpBitNot                 // R[A] = ~R[B]
+	OpAddr                   // R[A] = the address of register B, which holds a variable
+	OpLoad                   // R[A] = the value at the address R[B]
+	OpStore                  // the value at the address R[A] = R[B]
+	OpParam                  // R[A] = the argument B
+	OpCall                   // R[A] = function B called with R[C], R[C+1], ...
+	OpArgc                   // R[A] = argc()
+	OpArg                    // R[A] = arg(R[B])
+	OpGets                   // R[A] = gets()
+	OpEof                    // R[A] = eof()
+	OpPuts                   // puts R[A]
+	OpJmp                    // jump by A
+	OpJmpIf                  // jump by B if R[A] != 0
+	OpJmpIfNot               // jump by B if R[A] == 0
+	OpRet                    // return R[A]
+	opCount
+)
+
+var opcodeNames = [...]string{
+	OpLoadK:    "LOADK",
+	OpMove:     "MOVE",
+	OpAdd:      "ADD",
+	OpSub:      "SUB",
+	OpMul:      "MUL",
+	OpDiv:      "DIV",
+	OpMod:      "MOD",
+	OpAnd:      "AND",
+	OpOr:       "OR",
+	OpXor:      "XOR",
+	OpShl:      "SHL",
+	OpShr:      "SHR",
+	OpEq:       "EQ",
+	OpLt:       "LT",
+	OpLogAnd:   "LAND",
+	OpLogOr:    "LOR",
+	OpNot:      "NOT",
+	OpBitNot:   "BNOT",
+	OpAddr:     "ADDR",
+	OpLoad:     "LOAD",
+	OpStore:    "STORE",
+	OpParam:    "PARAM",
+	OpCall:     "CALL",
+	OpArgc:     "ARGC",
+	OpArg:      "ARG",
+	OpGets:     "GETS",
+	OpEof:      "EOF",
+	OpPuts:     "PUTS",
+	OpJmp:      "JMP",
+	OpJmpIf:    "JMPIF",
+	OpJmpIfNot: "JMPIFNOT",
+	OpRet:      "RET",
+}
+
+func (op Opcode) String() string {
+	if op < opCount {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP%d", uint8(op))
+}
+
+// operand kinds of instructions
+const (
+	noOperand       = iota
+	registerOperand // an index of a register of the frame
+	constantOperand // an index of the constant pool
+	functionOperand // an index of the function table
+	argumentOperand // an index of the arguments
+	offsetOperand   // a jump offset
+)
+
+// operands gives the kinds of the operands A, B and C of each opcode
+var operands = [...][3]int{
+	OpLoadK:    {registerOperand, constantOperand, noOperand},
+	OpMove:     {registerOperand, registerOperand, noOperand},
+	OpAdd:      {registerOperand, registerOperand, registerOperand},
+	OpSub:      {registerOperand, registerOperand, registerOperand},
+	OpMul:      {registerOperand, registerOperand, registerOperand},
+	OpDiv:      {registerOperand, registerOperand, registerOperand},
+	OpMod:      {registerOperand, registerOperand, registerOperand},
+	OpAnd:      {registerOperand, registerOperand, registerOperand},
+	OpOr:       {registerOperand, registerOperand, registerOperand},
+	OpXor:      {registerOperand, registerOperand, registerOperand},
+	OpShl:      {registerOperand, registerOperand, registerOperand},
+	OpShr:      {registerOperand, registerOperand, registerOperand},
+	OpEq:       {registerOperand, registerOperand, registerOperand},
+	OpLt:       {registerOperand, registerOperand, registerOperand},
+	OpLogAnd:   {registerOperand, registerOperand, registerOperand},
+	OpLogOr:    {registerOperand, registerOperand, registerOperand},
+	OpNot:      {registerOperand, registerOperand, noOperand},
+	OpBitNot:   {registerOperand, registerOperand, noOperand},
+	OpAddr:     {registerOperand, registerOperand, noOperand},
+	OpLoad:     {registerOperand, registerOperand, noOperand},
+	OpStore:    {registerOperand, registerOperand, noOperand},
+	OpParam:    {registerOperand, argumentOperand, noOperand},
+	OpCall:     {registerOperand, functionOperand, registerOperand},
+	OpArgc:     {registerOperand, noOperand, noOperand},
+	OpArg:      {registerOperand, registerOperand, noOperand},
+	OpGets:     {registerOperand, noOperand, noOperand},
+	OpEof:      {registerOperand, noOperand, noOperand},
+	OpPuts:     {registerOperand, noOperand, noOperand},
+	OpJmp:      {offsetOperand, noOperand, noOperand},
+	OpJmpIf:    {registerOperand, offsetOperand, noOperand},
+	OpJmpIfNot: {registerOperand, offsetOperand, noOperand},
+	OpRet:      {registerOperand, noOperand, noOperand},
+}
+
+// Instruction represents a single instruction. Unused operands are zero.
+type Instruction struct {
+	Op      Opcode
+	A, B, C int32
+}
+
+func (instr Instruction) String() string {
+	out := instr.Op.String()
+	for i, operand := range []int32{instr.A, instr.B, instr.C} {
+		if instr.Op >= opCount || operands[instr.Op][i] == noOperand {
+			break
+		}
+		if i > 0 {
+			out += ","
+		}
+		switch operands[instr.Op][i] {
+		case registerOperand:
+			out += fmt.Sprintf(" r%d", operand)
+		case constantOperand:
+			out += fmt.Sprintf(" k%d", operand)
+		case functionOperand:
+			out += fmt.Sprintf(" f%d", operand)
+		case argumentOperand:
+			out += fmt.Sprintf(" a%d", operand)
+		case offsetOperand:
+			out += fmt.Sprintf(" %+d", operand)
+		}
+	}
+	return out
+}
+
+// maxRegisters limits the size of frames
+const maxRegisters = 1 << 20
+
+// Function represents a compiled function.
+//
+// The frame of a function holds Registers registers. Variables occupy the
+// registers from 0, so that their addresses can be taken, and the registers
+// of the IR and the arguments of calls follow them. All registers start
+// from zero. Running past the last instruction returns 0.
+type Function struct {
+	Name       string
+	Parameters int
+	Registers  int
+	Code       []Instruction
+}
+
+// Program represents a compiled program
+type Program struct {
+	Constants []int64
+	Functions []*Function
+}
+
+// String returns the disassembly of the program
+func (p *Program) String() string {
+	var out bytes.Buffer
+
+	for i, value := range p.Constants {
+		fmt.Fprintf(&out, "k%d = %d\n", i, value)
+	}
+
+	for i, function := range p.Functions {
+		fmt.Fprintf(&out, "f%d %s (parameters %d, registers %d)\n",
+			i, function.Name, function.Parameters, function.Registers)
+		for pc, instr := range function.Code {
+			fmt.Fprintf(&out, "  %4d  %s\n", pc, instr)
+		}
+	}
+
+	return out.String()
+}
+
+// Verify checks that every operand of the program is in range, so that the
+// machine can run the program without checking them. Jumps may target the
+// end of the code.
+func (p *Program) Verify() error {
+	for _, function := range p.Functions {
+		if function.Parameters < 0 || function.Registers < 0 {
+			return fmt.Errorf("function '%s': negative size", function.Name)
+		}
+		if function.Registers > maxRegisters {
+			return fmt.Errorf("function '%s': %d registers exceed the limit of %d",
+				function.Name, function.Registers, maxRegisters)
+		}
+	}
+
+	for _, function := range p.Functions {
+		for pc, instr := range function.Code {
+			if instr.Op >= opCount {
+				return fmt.Errorf("function '%s': %d: unknown opcode %d", function.Name, pc, instr.Op)
+			}
+
+			for i, operand := range []int32{instr.A, instr.B, instr.C} {
+				var ok bool
+				switch operands[instr.Op][i] {
+				case noOperand:
+					ok = operand == 0
+				case registerOperand:
+					ok = 0 <= operand && int(operand) < function.Registers
+				case constantOperand:
+					ok = 0 <= operand && int(operand) < len(p.Constants)
+				case functionOperand:
+					ok = 0 <= operand && int(operand) < len(p.Functions)
+				case argumentOperand:
+					ok = 0 <= operand && int(operand) < function.Parameters
+				case offsetOperand:
+					target := pc + 1 + int(operand)
+					ok = 0 <= target && target <= len(function.Code)
+				}
+				if !ok {
+					return fmt.Errorf("function '%s': %d: operand %c of '%s' is out of range",
+						function.Name, pc, 'A'+i, instr)
+				}
+			}
+
+			// the arguments of a call are consecutive registers
+			if instr.Op == OpCall {
+				callee := p.Functions[instr.B]
+				if int(instr.C)+callee.Parameters > function.Registers {
+					return fmt.Errorf("function '%s': %d: the arguments of '%s' are out of range",
+						function.Name, pc, instr)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package bytecode
+
+import (
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+)
+
+func TestCompile(t *testing.T) {
+	program, err := ir.Parse("[main]\n.L0:\n  ARGC r0\n  JMP .L1\n.L1:\n  IMM r1, 1\n  r2 = r0 - r1\n" +
+		"  BR r2, .L2, .L3\n.L2:\n  PUTS r2\n  JMP .L1\n.L3:\n  IMM r3, 1\n  CALL r4, f(r0, r3)\n  RET r4\n" +
+		"[f]\n.L0:\n  STORE_ARG 0 a\n  STORE_ARG 1 b\n  BPREL r0, a\n  LOAD r1, [r0]\n  BR r1, .L1, .L1\n.L1:\n  RET r1\n")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	compiled, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	expected := "k0 = 1\n" +
+		"f0 main (parameters 0, registers 7)\n" +
+		"     0  ARGC r0\n" +
+		"     1  LOADK r1, k0\n" +
+		"     2  SUB r2, r0, r1\n" +
+		"     3  JMPIFNOT r2, +2\n" +
+		"     4  PUTS r2\n" +
+		"     5  JMP -5\n" +
+		"     6  LOADK r3, k0\n" +
+		"     7  MOVE r5, r0\n" +
+		"     8  MOVE r6, r3\n" +
+		"     9  CALL r4, f1, r5\n" +
+		"    10  RET r4\n" +
+		"f1 f (parameters 2, registers 4)\n" +
+		"     0  PARAM r0, a0\n" +
+		"     1  PARAM r1, a1\n" +
+		"     2  ADDR r2, r0\n" +
+		"     3  LOAD r3, r2\n" +
+		"     4  RET r3\n"
+	if compiled.String() != expected {
+		t.Errorf("wrong bytecode. expected=\n%s\ngot=\n%s", expected, compiled.String())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"[main]\n.L0:\n  CALL r0, f()\n  RET r0\n", "function 'main': function 'f' is not defined"},
+		{"[main]\n.L0:\n  IMM r0, 1\n  CALL r1, f(r0, r0)\n  RET r1\n[f]\n.L0:\n  STORE_ARG 0 a\n  IMM r0, 0\n  RET r0\n",
+			"function 'main': function 'f' takes 1 arguments but 2 are given"},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		_, err = Compile(program)
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		program *Program
+		err     string
+	}{
+		{
+			&Program{Functions: []*Function{{Name: "main", Registers: 1, Code: []Instruction{{Op: OpRet, A: 1}}}}},
+			"function 'main': 0: operand A of 'RET r1' is out of range",
+		},
+		{
+			&Program{Functions: []*Function{{Name: "main", Registers: 1, Code: []Instruction{{Op: OpLoadK, A: 0, B: 0}}}}},
+			"function 'main': 0: operand B of 'LOADK r0, k0' is out of range",
+		},
+		{
+			&Program{Functions: []*Function{{Name: "main", Code: []Instruction{{Op: OpJmp, A: 2}}}}},
+			"function 'main': 0: operand A of 'JMP +2' is out of range",
+		},
+		{
+			&Program{Functions: []*Function{{Name: "main", Code: []Instruction{{Op: OpPuts + 100}}}}},
+			"function 'main': 0: unknown opcode 127",
+		},
+		{
+			&Program{Functions: []*Function{
+				{Name: "main", Registers: 2, Code: []Instruction{{Op: OpCall, A: 0, B: 1, C: 1}}},
+				{Name: "f", Parameters: 2},
+			}},
+			"function 'main': 0: the arguments of 'CALL r0, f1, r1' are out of range",
+		},
+	}
+
+	for i, tt := range tests {
+		err := tt.program.Verify()
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
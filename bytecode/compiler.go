@@ -0,0 +1,277 @@
+package bytecode
+
+import (
+	"fmt"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+)
+
+// binaryOpcodes maps the binary operators of IR to opcodes
+var binaryOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"&":  OpAnd,
+	"|":  OpOr,
+	"^":  OpXor,
+	"<<": OpShl,
+	">>": OpShr,
+	"==": OpEq,
+	"<":  OpLt,
+	"&&": OpLogAnd,
+	"||": OpLogOr,
+}
+
+// compiler contains the state while compiling a program
+type compiler struct {
+	program   *Program
+	functions map[string]int
+	constants map[int64]int
+
+	// the state of the function being compiled
+	function  *Function
+	variables map[*ast.Variable]int
+	registers map[*ir.Register]int
+	arguments int // the first register for the arguments of calls
+	labels    map[*ir.BasicBlock]int
+	jumps     map[int]*ir.BasicBlock // the jumps to patch with their targets
+}
+
+// Compile translates program into bytecode. Registers of IR are numbered
+// densely in each function, jumps are resolved to offsets, calls to indexes
+// of the function table and immediate values to indexes of the constant
+// pool. Calls are checked against the parameters of their functions.
+func Compile(program *ir.Program) (*Program, error) {
+	c := &compiler{
+		program:   &Program{Constants: []int64{}, Functions: []*Function{}},
+		functions: make(map[string]int),
+		constants: make(map[int64]int),
+	}
+
+	for i, function := range program.Functions {
+		c.functions[function.Node.Name] = i
+		c.program.Functions = append(c.program.Functions, &Function{
+			Name:       function.Node.Name,
+			Parameters: len(function.Node.Parameters),
+			Code:       []Instruction{},
+		})
+	}
+
+	for i, function := range program.Functions {
+		c.function = c.program.Functions[i]
+		if err := c.compileFunction(function); err != nil {
+			return nil, fmt.Errorf("function '%s': %s", function.Node.Name, err)
+		}
+	}
+
+	if err := c.program.Verify(); err != nil {
+		return nil, err
+	}
+
+	return c.program, nil
+}
+
+func (c *compiler) compileFunction(function *ir.Function) error {
+	c.variables = make(map[*ast.Variable]int)
+	c.registers = make(map[*ir.Register]int)
+	c.labels = make(map[*ir.BasicBlock]int)
+	c.jumps = make(map[int]*ir.BasicBlock)
+
+	for i, variable := range function.Node.Variables {
+		c.variables[variable] = i
+	}
+
+	next := len(function.Node.Variables)
+	arguments := 0
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			rs := ir.Uses(instr)
+			if r := ir.Def(instr); r != nil {
+				rs = append(rs, r)
+			}
+			for _, r := range rs {
+				if _, ok := c.registers[r]; !ok {
+					c.registers[r] = next
+					next++
+				}
+			}
+			if call, ok := instr.(*ir.CallIr); ok && len(call.Arguments) > arguments {
+				arguments = len(call.Arguments)
+			}
+		}
+	}
+	c.arguments = next
+	c.function.Registers = next + arguments
+
+	for i, bb := range function.BasicBlocks {
+		var following *ir.BasicBlock
+		if i+1 < len(function.BasicBlocks) {
+			following = function.BasicBlocks[i+1]
+		}
+
+		c.labels[bb] = len(c.function.Code)
+		for _, instr := range bb.Irs {
+			if err := c.compileInstruction(instr, following); err != nil {
+				return err
+			}
+		}
+	}
+
+	for pc, target := range c.jumps {
+		label, ok := c.labels[target]
+		if !ok {
+			return fmt.Errorf("jump to unknown block .L%d", target.Label)
+		}
+
+		instr := &c.function.Code[pc]
+		if instr.Op == OpJmp {
+			instr.A = int32(label - pc - 1)
+		} else {
+			instr.B = int32(label - pc - 1)
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) compileInstruction(instr ir.Ir, following *ir.BasicBlock) error {
+	switch instr := instr.(type) {
+	case *ir.ImmIr:
+		c.emit(OpLoadK, c.register(instr.R), c.constant(instr.Value))
+	case *ir.MovIr:
+		c.emit(OpMove, c.register(instr.R0), c.register(instr.R1))
+	case *ir.BinaryOpIr:
+		op, ok := binaryOpcodes[instr.Operator]
+		if !ok {
+			return fmt.Errorf("unknown binary operator %s", instr.Operator)
+		}
+		c.emit(op, c.register(instr.R0), c.register(instr.R1), c.register(instr.R2))
+	case *ir.UnaryOpIr:
+		switch instr.Operator {
+		case "!":
+			c.emit(OpNot, c.register(instr.R0), c.register(instr.R1))
+		case "~":
+			c.emit(OpBitNot, c.register(instr.R0), c.register(instr.R1))
+		default:
+			return fmt.Errorf("unknown unary operator %s", instr.Operator)
+		}
+	case *ir.BprelIr:
+		variable, err := c.variable(instr.Var)
+		if err != nil {
+			return err
+		}
+		c.emit(OpAddr, c.register(instr.R), variable)
+	case *ir.LoadIr:
+		c.emit(OpLoad, c.register(instr.R0), c.register(instr.R1))
+	case *ir.StoreIr:
+		c.emit(OpStore, c.register(instr.R0), c.register(instr.R1))
+	case *ir.StoreArgIr:
+		variable, err := c.variable(instr.Var)
+		if err != nil {
+			return err
+		}
+		if instr.Index >= c.function.Parameters {
+			return fmt.Errorf("missing argument %d", instr.Index)
+		}
+		c.emit(OpParam, variable, int32(instr.Index))
+	case *ir.CallIr:
+		index, ok := c.functions[instr.Function]
+		if !ok {
+			return fmt.Errorf("function '%s' is not defined", instr.Function)
+		}
+		if parameters := c.program.Functions[index].Parameters; len(instr.Arguments) != parameters {
+			return fmt.Errorf("function '%s' takes %d arguments but %d are given",
+				instr.Function, parameters, len(instr.Arguments))
+		}
+		// C is 0 without arguments, so that it is always a register
+		first := 0
+		if len(instr.Arguments) > 0 {
+			first = c.arguments
+		}
+		for i, r := range instr.Arguments {
+			c.emit(OpMove, int32(first+i), c.register(r))
+		}
+		c.emit(OpCall, c.register(instr.Return), int32(index), int32(first))
+	case *ir.ArgcIr:
+		c.emit(OpArgc, c.register(instr.R))
+	case *ir.ArgIr:
+		c.emit(OpArg, c.register(instr.R0), c.register(instr.R1))
+	case *ir.GetsIr:
+		c.emit(OpGets, c.register(instr.R))
+	case *ir.EofIr:
+		c.emit(OpEof, c.register(instr.R))
+	case *ir.PutsIr:
+		c.emit(OpPuts, c.register(instr.R))
+	case *ir.JmpIr:
+		c.jump(instr.Target, following)
+	case *ir.BrIr:
+		switch following {
+		case instr.Consequence:
+			if instr.Alternative != following {
+				c.jumps[len(c.function.Code)] = instr.Alternative
+				c.emit(OpJmpIfNot, c.register(instr.R))
+			}
+		case instr.Alternative:
+			c.jumps[len(c.function.Code)] = instr.Consequence
+			c.emit(OpJmpIf, c.register(instr.R))
+		default:
+			c.jumps[len(c.function.Code)] = instr.Consequence
+			c.emit(OpJmpIf, c.register(instr.R))
+			c.jump(instr.Alternative, nil)
+		}
+	case *ir.RetIr:
+		c.emit(OpRet, c.register(instr.R))
+	case *ir.NopIr:
+	default:
+		return fmt.Errorf("unknown instruction: %s", instr.String())
+	}
+
+	return nil
+}
+
+// jump jumps to target unless it is the following block
+func (c *compiler) jump(target *ir.BasicBlock, following *ir.BasicBlock) {
+	if target == following {
+		return
+	}
+	c.jumps[len(c.function.Code)] = target
+	c.emit(OpJmp)
+}
+
+func (c *compiler) register(r *ir.Register) int32 {
+	return int32(c.registers[r])
+}
+
+func (c *compiler) variable(variable *ast.Variable) (int32, error) {
+	index, ok := c.variables[variable]
+	if !ok {
+		return 0, fmt.Errorf("variable '%s' has no slot", variable.Name)
+	}
+	return int32(index), nil
+}
+
+// constant returns the index of value in the constant pool, adding it if
+// needed
+func (c *compiler) constant(value int64) int32 {
+	index, ok := c.constants[value]
+	if !ok {
+		index = len(c.program.Constants)
+		c.constants[value] = index
+		c.program.Constants = append(c.program.Constants, value)
+	}
+	return int32(index)
+}
+
+// emit appends an instruction with the operands A, B and C, of which the
+// omitted ones are zero
+func (c *compiler) emit(op Opcode, operands ...int32) {
+	instr := Instruction{Op: op}
+	fields := []*int32{&instr.A, &instr.B, &instr.C}
+	for i, operand := range operands {
+		*fields[i] = operand
+	}
+	c.function.Code = append(c.function.Code, instr)
+}
@@ -0,0 +1,195 @@
+package bytecode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// magic starts every .beec file and version is the version of the format
+const (
+	magic   = "BEEC"
+	version = 1
+)
+
+// maxNameLength limits the length of function names to reject corrupted
+// files before allocating memory for them
+const maxNameLength = 1 << 16
+
+// Encode writes program to w in the .beec format:
+//
+//	"BEEC" version:byte
+//	constants:uvarint (value:varint)*
+//	functions:uvarint (name:uvarint byte* parameters:uvarint registers:uvarint
+//	                   code:uvarint (op:byte A:varint B:varint C:varint)*)*
+func Encode(w io.Writer, program *Program) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	uvarint := func(value uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf, value)])
+	}
+	varint := func(value int64) {
+		bw.Write(buf[:binary.PutVarint(buf, value)])
+	}
+
+	bw.WriteString(magic)
+	bw.WriteByte(version)
+
+	uvarint(uint64(len(program.Constants)))
+	for _, value := range program.Constants {
+		varint(value)
+	}
+
+	uvarint(uint64(len(program.Functions)))
+	for _, function := range program.Functions {
+		uvarint(uint64(len(function.Name)))
+		bw.WriteString(function.Name)
+		uvarint(uint64(function.Parameters))
+		uvarint(uint64(function.Registers))
+		uvarint(uint64(len(function.Code)))
+		for _, instr := range function.Code {
+			bw.WriteByte(byte(instr.Op))
+			varint(int64(instr.A))
+			varint(int64(instr.B))
+			varint(int64(instr.C))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// decoder reads a .beec file and keeps the first error
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errors.New("unexpected end of file")
+		}
+		d.err = err
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	return value
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(d.r)
+	d.fail(err)
+	return value
+}
+
+// size reads a count or a size, which must fit in an int32
+func (d *decoder) size() int {
+	value := d.uvarint()
+	if value > math.MaxInt32 {
+		d.fail(fmt.Errorf("size %d is too large", value))
+		return 0
+	}
+	return int(value)
+}
+
+// operand reads an operand, which must fit in an int32
+func (d *decoder) operand() int32 {
+	value := d.varint()
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		d.fail(fmt.Errorf("operand %d is too large", value))
+		return 0
+	}
+	return int32(value)
+}
+
+// Decode reads a program in the .beec format from r and verifies it
+func Decode(r io.Reader) (*Program, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(d.r, header); err != nil || string(header) != magic {
+		return nil, errors.New("not a bee bytecode file")
+	}
+	if v := d.byte(); d.err == nil && v != version {
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+
+	program := &Program{Constants: []int64{}, Functions: []*Function{}}
+
+	// slices grow while reading so that corrupted counts fail at the end of
+	// the file instead of allocating too much memory
+	constants := d.size()
+	for i := 0; i < constants && d.err == nil; i++ {
+		program.Constants = append(program.Constants, d.varint())
+	}
+
+	functions := d.size()
+	for i := 0; i < functions && d.err == nil; i++ {
+		length := d.size()
+		if length > maxNameLength {
+			d.fail(fmt.Errorf("function name of %d bytes is too long", length))
+			break
+		}
+		name := make([]byte, length)
+		if d.err == nil {
+			_, err := io.ReadFull(d.r, name)
+			d.fail(err)
+		}
+
+		function := &Function{
+			Name:       string(name),
+			Parameters: d.size(),
+			Registers:  d.size(),
+			Code:       []Instruction{},
+		}
+
+		code := d.size()
+		for pc := 0; pc < code && d.err == nil; pc++ {
+			function.Code = append(function.Code, Instruction{
+				Op: Opcode(d.byte()),
+				A:  d.operand(),
+				B:  d.operand(),
+				C:  d.operand(),
+			})
+		}
+
+		program.Functions = append(program.Functions, function)
+	}
+
+	if d.err == nil {
+		if _, err := d.r.ReadByte(); err != io.EOF {
+			d.fail(errors.New("unexpected data after the end of the program"))
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := program.Verify(); err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
@@ -0,0 +1,83 @@
+package bytecode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []string{
+		"fn main() {}",
+		"fn main() { x = 9223372036854775807; puts x + 1; puts 0 - 1; return f(1, 2); } fn f(a, b) { return a - b; }",
+		"fn main() { i = 0; while (i < 3) { if (i == 1) { puts i; } i++; } return sq(i); } fn sq(x) { return x * x; }",
+	}
+
+	for i, input := range tests {
+		compiled, err := Compile(testutil.Compile(t, input, 0))
+		if err != nil {
+			t.Fatalf("[test-%d] compile error: %s", i, err)
+		}
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, compiled); err != nil {
+			t.Fatalf("[test-%d] encode error: %s", i, err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("BEEC\x01")) {
+			t.Errorf("[test-%d] wrong header %q", i, buf.Bytes()[:5])
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("[test-%d] decode error: %s", i, err)
+		}
+		if !reflect.DeepEqual(decoded, compiled) {
+			t.Errorf("[test-%d] program does not round-trip. expected=\n%s\ngot=\n%s", i, compiled, decoded)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := func(program *Program) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, program); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	program := &Program{
+		Constants: []int64{-1},
+		Functions: []*Function{{Name: "main", Registers: 1, Code: []Instruction{{Op: OpLoadK}, {Op: OpRet}}}},
+	}
+	encoded := valid(program)
+
+	tests := []struct {
+		input []byte
+		err   string
+	}{
+		{[]byte{}, "not a bee bytecode file"},
+		{[]byte("#!/bin/sh\n"), "not a bee bytecode file"},
+		{[]byte("BEEC\x02"), "unsupported version 2"},
+		{[]byte("BEEC"), "unexpected end of file"},
+		{encoded[:len(encoded)-1], "unexpected end of file"},
+		{append(append([]byte{}, encoded...), 0), "unexpected data after the end of the program"},
+		{[]byte("BEEC\x01\x00\x01\xff\xff\x04"), "function name of 81919 bytes is too long"},
+		{[]byte("BEEC\x01\x00\x01\x04main\x00\x01\x01\x00\x00\x02\x00"), "function 'main': 0: operand B of 'LOADK r0, k1' is out of range"},
+		{[]byte("BEEC\x01\x00\x01\x04main\x00\x00\x01\xff\x00\x00\x00"), "function 'main': 0: unknown opcode 255"},
+		{[]byte("BEEC\x01\x00\x01\x04main\x00\x00\x01\x00\x80\x80\x80\x80\x20\x00\x00"), "operand 4294967296 is too large"},
+	}
+
+	for i, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
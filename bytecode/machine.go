@@ -0,0 +1,283 @@
+package bytecode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/d2verb/bee/ir"
+)
+
+// maxCallDepth limits the depth of nested calls like in the VM
+const maxCallDepth = 10000
+
+// Machine executes bytecode. Unlike the VM, which interprets IR, it runs a
+// flat instruction stream on a single stack of registers without recursion
+// in Go and without looking up registers, labels or functions by name.
+type Machine struct {
+	program *Program
+	args    []string
+	in      *bufio.Scanner
+	eof     bool // set when GETS has reached the end of input
+	out     io.Writer
+	stack   []int64 // the registers of all active frames
+}
+
+// frame holds the state of a suspended caller or the running function
+type frame struct {
+	function  *Function
+	base      int // the index of the first register in the stack
+	pc        int
+	arguments int // the index of the first argument in the stack
+	result    int // the index of the register of the caller for the return value
+}
+
+// NewMachine returns a new machine which passes args to the program as
+// command-line arguments, reads the input of `gets` from in and writes the
+// output of `puts` to out. program must be verified.
+func NewMachine(program *Program, args []string, in io.Reader, out io.Writer) *Machine {
+	scanner := bufio.NewScanner(in)
+	scanner.Split(bufio.ScanWords)
+
+	return &Machine{
+		program: program,
+		args:    args,
+		in:      scanner,
+		out:     out,
+	}
+}
+
+// Run executes `main` and returns its return value
+func (m *Machine) Run() (int64, error) {
+	for _, function := range m.program.Functions {
+		if function.Name != "main" {
+			continue
+		}
+		if function.Parameters != 0 {
+			return 0, fmt.Errorf("function 'main' takes %d arguments but 0 are given", function.Parameters)
+		}
+		return m.execute(function)
+	}
+	return 0, fmt.Errorf("function 'main' is not defined")
+}
+
+func (m *Machine) execute(main *Function) (int64, error) {
+	constants := m.program.Constants
+	functions := m.program.Functions
+	frames := []frame{}
+
+	f := frame{function: main}
+	m.stack = make([]int64, main.Registers)
+
+	code := f.function.Code
+	regs := m.stack
+
+	for {
+		var returned int64
+
+		if f.pc < len(code) {
+			instr := code[f.pc]
+			f.pc++
+
+			switch instr.Op {
+			case OpLoadK:
+				regs[instr.A] = constants[instr.B]
+			case OpMove:
+				regs[instr.A] = regs[instr.B]
+			case OpAdd:
+				regs[instr.A] = regs[instr.B] + regs[instr.C]
+			case OpSub:
+				regs[instr.A] = regs[instr.B] - regs[instr.C]
+			case OpMul:
+				regs[instr.A] = regs[instr.B] * regs[instr.C]
+			case OpDiv:
+				// -1 is handled separately to wrap around like ir.EvalBinary
+				switch divisor := regs[instr.C]; divisor {
+				case 0:
+					return 0, ir.ErrDivisionByZero
+				case -1:
+					regs[instr.A] = -regs[instr.B]
+				default:
+					regs[instr.A] = regs[instr.B] / divisor
+				}
+			case OpMod:
+				switch divisor := regs[instr.C]; divisor {
+				case 0:
+					return 0, ir.ErrDivisionByZero
+				case -1:
+					regs[instr.A] = 0
+				default:
+					regs[instr.A] = regs[instr.B] % divisor
+				}
+			case OpAnd:
+				regs[instr.A] = regs[instr.B] & regs[instr.C]
+			case OpOr:
+				regs[instr.A] = regs[instr.B] | regs[instr.C]
+			case OpXor:
+				regs[instr.A] = regs[instr.B] ^ regs[instr.C]
+			case OpShl:
+				regs[instr.A] = regs[instr.B] << (uint64(regs[instr.C]) & 63)
+			case OpShr:
+				regs[instr.A] = regs[instr.B] >> (uint64(regs[instr.C]) & 63)
+			case OpEq:
+				regs[instr.A] = boolToInt(regs[instr.B] == regs[instr.C])
+			case OpLt:
+				regs[instr.A] = boolToInt(regs[instr.B] < regs[instr.C])
+			case OpLogAnd:
+				regs[instr.A] = boolToInt(regs[instr.B] != 0 && regs[instr.C] != 0)
+			case OpLogOr:
+				regs[instr.A] = boolToInt(regs[instr.B] != 0 || regs[instr.C] != 0)
+			case OpNot:
+				regs[instr.A] = boolToInt(regs[instr.B] == 0)
+			case OpBitNot:
+				regs[instr.A] = ^regs[instr.B]
+			case OpAddr:
+				regs[instr.A] = int64(f.base + int(instr.B))
+			case OpLoad:
+				address := regs[instr.B]
+				if err := m.checkAddress(address); err != nil {
+					return 0, err
+				}
+				regs[instr.A] = m.stack[address]
+			case OpStore:
+				address := regs[instr.A]
+				if err := m.checkAddress(address); err != nil {
+					return 0, err
+				}
+				m.stack[address] = regs[instr.B]
+			case OpParam:
+				regs[instr.A] = m.stack[f.arguments+int(instr.B)]
+			case OpCall:
+				callee := functions[instr.B]
+				if len(frames)+1 >= maxCallDepth {
+					return 0, fmt.Errorf("stack overflow in function '%s'", callee.Name)
+				}
+
+				frames = append(frames, f)
+				f = frame{
+					function:  callee,
+					base:      len(m.stack),
+					arguments: f.base + int(instr.C),
+					result:    f.base + int(instr.A),
+				}
+				m.grow(f.base + callee.Registers)
+
+				code = f.function.Code
+				regs = m.stack[f.base:]
+			case OpArgc:
+				regs[instr.A] = int64(len(m.args))
+			case OpArg:
+				value, err := m.arg(regs[instr.B])
+				if err != nil {
+					return 0, err
+				}
+				regs[instr.A] = value
+			case OpGets:
+				value, err := m.gets()
+				if err != nil {
+					return 0, err
+				}
+				regs[instr.A] = value
+			case OpEof:
+				regs[instr.A] = boolToInt(m.eof)
+			case OpPuts:
+				fmt.Fprintln(m.out, regs[instr.A])
+			case OpJmp:
+				f.pc += int(instr.A)
+			case OpJmpIf:
+				if regs[instr.A] != 0 {
+					f.pc += int(instr.B)
+				}
+			case OpJmpIfNot:
+				if regs[instr.A] == 0 {
+					f.pc += int(instr.B)
+				}
+			case OpRet:
+				returned = regs[instr.A]
+			default:
+				return 0, fmt.Errorf("unknown opcode %d", instr.Op)
+			}
+
+			if instr.Op != OpRet {
+				continue
+			}
+		}
+
+		// running past the last instruction returns 0
+		if len(frames) == 0 {
+			return returned, nil
+		}
+
+		result := f.result
+		m.stack = m.stack[:f.base]
+		f = frames[len(frames)-1]
+		frames = frames[:len(frames)-1]
+		m.stack[result] = returned
+
+		code = f.function.Code
+		regs = m.stack[f.base:]
+	}
+}
+
+// grow extends the stack to size registers, which start from zero
+func (m *Machine) grow(size int) {
+	top := len(m.stack)
+	if size > cap(m.stack) {
+		stack := make([]int64, top, 2*size)
+		copy(stack, m.stack)
+		m.stack = stack
+	}
+	m.stack = m.stack[:size]
+
+	registers := m.stack[top:]
+	for i := range registers {
+		registers[i] = 0
+	}
+}
+
+func (m *Machine) arg(index int64) (int64, error) {
+	if index < 0 || index >= int64(len(m.args)) {
+		return 0, fmt.Errorf("argument index %d out of range", index)
+	}
+
+	value, err := strconv.ParseInt(m.args[index], 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d (%q) is not an integer", index, m.args[index])
+	}
+
+	return value, nil
+}
+
+// gets reads the next whitespace separated integer from the input.
+// At the end of input it returns 0 and sets the EOF flag.
+func (m *Machine) gets() (int64, error) {
+	if !m.in.Scan() {
+		if err := m.in.Err(); err != nil {
+			return 0, err
+		}
+		m.eof = true
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(m.in.Text(), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("input %q is not an integer", m.in.Text())
+	}
+
+	return value, nil
+}
+
+func (m *Machine) checkAddress(address int64) error {
+	if address < 0 || address >= int64(len(m.stack)) {
+		return fmt.Errorf("invalid memory access at address %d", address)
+	}
+	return nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
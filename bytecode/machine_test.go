@@ -0,0 +1,152 @@
+package bytecode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/vm"
+)
+
+// TestRun compares the machine with the VM
+func TestRun(t *testing.T) {
+	tests := []testutil.Case{
+		{Input: "fn main() {}"},
+		{Input: "fn main() { return 42; }"},
+		{Input: "fn main() { x = 3; y = x * x; puts y; return y - 9; }"},
+		{Input: "fn main() { i = 0; while (i < 3) { puts i; i = i + 1; } return i; }"},
+		{Input: "fn main() { x = 10; x += 5; x -= 3; x *= 4; x /= 6; x++; x++; x--; return x; }"},
+		{Input: "fn main() { return fact(5); } fn fact(n) { if (n < 2) { return 1; } return n * fact(n - 1); }"},
+		{Input: "fn main() { puts f(2); puts f(3); } fn f(x) { if (x == 2) { y = x; } return y; }"},
+		{Input: "fn main() { return gcd(1071, 462); } fn gcd(a, b) { if (b == 0) { return a; } return gcd(b, a % b); }"},
+		{Input: "fn main() { return even(10); } fn even(n) { if (n == 0) { return 1; } return odd(n - 1); } fn odd(n) { if (n == 0) { return 0; } return even(n - 1); }"},
+		{Input: "fn main() { x = 7; y = 3; puts x / y; puts x % y; puts x & y; puts x | 8; puts x ^ y; puts ~x; puts x << y; puts 0 - x >> 1; puts x << 65; }"},
+		{Input: "fn main() { x = 0; y = 5; puts !x; puts !y; puts x == x; puts x < y; puts x && y; puts x || y; }"},
+		{Input: "fn main() { x = 9223372036854775807; puts x + 1; y = 0 - 1; puts (x + 1) / y; puts (x + 1) % y; puts x * x; }"},
+		{Input: "fn main() { return f(1, 2, 3) + f(4, 5, 6) * g(); } fn f(a, b, c) { return a * 100 + b * 10 + c; } fn g() { return 2; }"},
+		{Input: "fn main() { puts argc(); puts arg(0) + arg(1); }", Args: []string{"40", "0x2"}},
+		{Input: "fn main() { s = 0; x = gets(); while (!eof()) { s = s + x; x = gets(); } return s; }", Stdin: "1 2\n 3\n"},
+		{Input: "fn main() { return count(100000, 0); } fn count(n, acc) { if (n == 0) { return acc % 256; } return count(n - 1, acc + 1); }"},
+	}
+
+	testutil.CompareWithVM(t, tests, func(t *testing.T, program *ir.Program, args []string, stdin string) (string, int64, error) {
+		compiled, err := Compile(program)
+		if err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		var out bytes.Buffer
+		code, err := NewMachine(compiled, args, strings.NewReader(stdin), &out).Run()
+		return out.String(), code, err
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"fn main() { x = 0; return 1 / x; }", "division by zero"},
+		{"fn main() { x = 0; return 1 % x; }", "division by zero"},
+		{"fn main() { return main() + 1; }", "stack overflow in function 'main'"},
+		{"fn main() { return arg(0); }", "argument index 0 out of range"},
+		{"fn main() { return gets(); }", "input \"x\" is not an integer"},
+	}
+
+	for i, tt := range tests {
+		compiled, err := Compile(testutil.Compile(t, tt.input, 1))
+		if err != nil {
+			t.Fatalf("[test-%d] compile error: %s", i, err)
+		}
+
+		_, err = NewMachine(compiled, []string{}, strings.NewReader("x"), &bytes.Buffer{}).Run()
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
+
+func TestParsedIR(t *testing.T) {
+	tests := []struct {
+		input    string
+		output   string
+		exitCode int64
+		err      string
+	}{
+		// running past the last instruction returns 0
+		{"[main]\n.L0:\n  IMM r0, 5\n  PUTS r0\n", "5\n", 0, ""},
+		{"[main]\n.L0:\n  IMM r0, 1000\n  LOAD r1, [r0]\n  RET r1\n", "", 0, "invalid memory access at address 1000"},
+		{"[f]\n.L0:\n  IMM r0, 0\n  RET r0\n", "", 0, "function 'main' is not defined"},
+		// a variable of the caller is written through its address
+		{"[main]\n.L0:\n  BPREL r0, x\n  CALL r1, f(r0)\n  LOAD r2, [r0]\n  RET r2\n" +
+			"[f]\n.L0:\n  STORE_ARG 0 p\n  BPREL r0, p\n  LOAD r1, [r0]\n  IMM r2, 7\n  STORE [r1], r2\n  RET r2\n", "", 7, ""},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+		compiled, err := Compile(program)
+		if err != nil {
+			t.Fatalf("[test-%d] compile error: %s", i, err)
+		}
+
+		var out bytes.Buffer
+		exitCode, err := NewMachine(compiled, []string{}, strings.NewReader(""), &out).Run()
+
+		errString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		if errString != tt.err || out.String() != tt.output || exitCode != tt.exitCode {
+			t.Errorf("[test-%d] wrong result. expected=(%q, %d, %q), got=(%q, %d, %q)",
+				i, tt.output, tt.exitCode, tt.err, out.String(), exitCode, errString)
+		}
+	}
+}
+
+// benchmarks are the programs to compare the machine with the VM
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"Loop", "fn main() { i = 0; s = 0; while (i < 100000) { s = s + i * i % 7; i++; } return s % 256; }"},
+	{"Fib", "fn main() { return fib(20) % 256; } fn fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); }"},
+}
+
+func BenchmarkVM(b *testing.B) {
+	for _, bm := range benchmarks {
+		program := testutil.Compile(b, bm.input, 2)
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := vm.New(program, nil, strings.NewReader(""), ioutil.Discard).Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMachine(b *testing.B) {
+	for _, bm := range benchmarks {
+		compiled, err := Compile(testutil.Compile(b, bm.input, 2))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := NewMachine(compiled, nil, strings.NewReader(""), ioutil.Discard).Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package cgen
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/toolchain"
+)
+
+// Generator translates IR into a single C translation unit which includes
+// the runtime, so that it can be built with any C compiler, e.g.
+// `cc -o prog prog.c`.
+//
+// Registers and variables become locals of type long long, basic blocks
+// become labels and jumps become gotos. Arithmetic is done on unsigned long
+// long so that it wraps around instead of being undefined, and division goes
+// through helpers which fail on zero like the VM.
+type Generator struct {
+	program *ir.Program
+	out     bytes.Buffer
+
+	// the state of the function being generated
+	variables map[*ast.Variable]string
+	targets   map[*ir.BasicBlock]bool
+}
+
+// New returns a new generator for program
+func New(program *ir.Program) *Generator {
+	return &Generator{program: program}
+}
+
+// prelude defines the helpers used by the generated code
+const prelude = `#include <stdint.h>
+
+long long bee_rt_div(long long a, long long b) {
+	if (b == 0) {
+		bee_division_by_zero();
+	}
+	/* LLONG_MIN / -1 overflows */
+	if (b == -1) {
+		return (long long)(0ULL - (unsigned long long)a);
+	}
+	return a / b;
+}
+
+long long bee_rt_mod(long long a, long long b) {
+	if (b == 0) {
+		bee_division_by_zero();
+	}
+	if (b == -1) {
+		return 0;
+	}
+	return a % b;
+}
+`
+
+// Generate generates the C source of the whole program
+func (g *Generator) Generate() string {
+	g.out.Reset()
+
+	g.out.WriteString(toolchain.RuntimeSource)
+	g.emit("")
+	g.out.WriteString(prelude)
+	g.emit("")
+
+	for _, function := range g.program.Functions {
+		g.emit("%s;", g.signature(function))
+	}
+
+	for _, function := range g.program.Functions {
+		g.emit("")
+		g.generateFunction(function)
+	}
+
+	return g.out.String()
+}
+
+func (g *Generator) signature(function *ir.Function) string {
+	parameters := ""
+	for i := range function.Node.Parameters {
+		if i > 0 {
+			parameters += ", "
+		}
+		parameters += fmt.Sprintf("long long p%d", i)
+	}
+	if parameters == "" {
+		parameters = "void"
+	}
+	return fmt.Sprintf("long long %s(%s)", toolchain.Symbol(function.Node.Name), parameters)
+}
+
+func (g *Generator) generateFunction(function *ir.Function) {
+	g.variables = make(map[*ast.Variable]string)
+	g.targets = make(map[*ir.BasicBlock]bool)
+
+	g.emit("%s {", g.signature(function))
+
+	// variables start from zero
+	for i, variable := range function.Node.Variables {
+		g.variables[variable] = fmt.Sprintf("v%d", i)
+		g.emit("\tlong long v%d = 0; /* %s */", i, variable.Name)
+	}
+
+	declared := make(map[*ir.Register]bool)
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			rs := ir.Uses(instr)
+			if r := ir.Def(instr); r != nil {
+				rs = append(rs, r)
+			}
+			for _, r := range rs {
+				if !declared[r] {
+					declared[r] = true
+					g.emit("\tlong long %s;", r)
+				}
+			}
+
+		}
+	}
+
+	// only the targets of gotos get labels to avoid unused labels
+	for i, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			switch instr := instr.(type) {
+			case *ir.JmpIr:
+				if instr.Target != g.next(function, i) {
+					g.targets[instr.Target] = true
+				}
+			case *ir.BrIr:
+				g.targets[instr.Consequence] = true
+				if instr.Alternative != g.next(function, i) {
+					g.targets[instr.Alternative] = true
+				}
+			}
+		}
+	}
+
+	for i, bb := range function.BasicBlocks {
+		next := g.next(function, i)
+
+		if g.targets[bb] {
+			g.emit("L%d:;", bb.Label)
+		}
+		for _, instr := range bb.Irs {
+			g.generateInstruction(instr, next)
+		}
+	}
+
+	// falling off the end returns 0 like in the VM
+	g.emit("\treturn 0;")
+	g.emit("}")
+}
+
+// next returns the block following function.BasicBlocks[i], or nil
+func (g *Generator) next(function *ir.Function, i int) *ir.BasicBlock {
+	if i+1 < len(function.BasicBlocks) {
+		return function.BasicBlocks[i+1]
+	}
+	return nil
+}
+
+func (g *Generator) generateInstruction(instr ir.Ir, next *ir.BasicBlock) {
+	switch instr := instr.(type) {
+	case *ir.ImmIr:
+		if instr.Value == math.MinInt64 {
+			// the most negative value cannot be written as a literal
+			g.emit("\t%s = -9223372036854775807LL - 1;", instr.R)
+		} else {
+			g.emit("\t%s = %dLL;", instr.R, instr.Value)
+		}
+	case *ir.MovIr:
+		g.emit("\t%s = %s;", instr.R0, instr.R1)
+	case *ir.BinaryOpIr:
+		g.emit("\t%s = %s;", instr.R0, binary(instr.Operator, instr.R1.String(), instr.R2.String()))
+	case *ir.UnaryOpIr:
+		switch instr.Operator {
+		case "!":
+			g.emit("\t%s = %s == 0;", instr.R0, instr.R1)
+		case "~":
+			g.emit("\t%s = ~%s;", instr.R0, instr.R1)
+		}
+	case *ir.BprelIr:
+		g.emit("\t%s = (long long)(intptr_t)&%s;", instr.R, g.variables[instr.Var])
+	case *ir.LoadIr:
+		g.emit("\t%s = *(long long *)(intptr_t)%s;", instr.R0, instr.R1)
+	case *ir.StoreIr:
+		g.emit("\t*(long long *)(intptr_t)%s = %s;", instr.R0, instr.R1)
+	case *ir.StoreArgIr:
+		g.emit("\t%s = p%d;", g.variables[instr.Var], instr.Index)
+	case *ir.CallIr:
+		arguments := ""
+		for i, r := range instr.Arguments {
+			if i > 0 {
+				arguments += ", "
+			}
+			arguments += r.String()
+		}
+		g.emit("\t%s = %s(%s);", instr.Return, toolchain.Symbol(instr.Function), arguments)
+	case *ir.ArgcIr:
+		g.emit("\t%s = bee_argc();", instr.R)
+	case *ir.ArgIr:
+		g.emit("\t%s = bee_arg(%s);", instr.R0, instr.R1)
+	case *ir.GetsIr:
+		g.emit("\t%s = bee_gets();", instr.R)
+	case *ir.EofIr:
+		g.emit("\t%s = bee_eof();", instr.R)
+	case *ir.PutsIr:
+		g.emit("\tprintf(\"%%lld\\n\", %s);", instr.R)
+	case *ir.JmpIr:
+		if instr.Target != next {
+			g.emit("\tgoto L%d;", instr.Target.Label)
+		}
+	case *ir.BrIr:
+		if instr.Alternative == next {
+			g.emit("\tif (%s) goto L%d;", instr.R, instr.Consequence.Label)
+		} else {
+			g.emit("\tif (%s) goto L%d; else goto L%d;", instr.R, instr.Consequence.Label, instr.Alternative.Label)
+		}
+	case *ir.RetIr:
+		g.emit("\treturn %s;", instr.R)
+	case *ir.NopIr:
+	}
+}
+
+// binary returns the C expression computing `a op b` like ir.EvalBinary
+func binary(op string, a string, b string) string {
+	switch op {
+	case "+", "-", "*":
+		return fmt.Sprintf("(long long)((unsigned long long)%s %s (unsigned long long)%s)", a, op, b)
+	case "<<":
+		return fmt.Sprintf("(long long)((unsigned long long)%s << (%s & 63))", a, b)
+	case ">>":
+		// right shifts of negative values are arithmetic on all supported compilers
+		return fmt.Sprintf("%s >> (%s & 63)", a, b)
+	case "/":
+		return fmt.Sprintf("bee_rt_div(%s, %s)", a, b)
+	case "%":
+		return fmt.Sprintf("bee_rt_mod(%s, %s)", a, b)
+	case "&&":
+		return fmt.Sprintf("%s != 0 && %s != 0", a, b)
+	case "||":
+		return fmt.Sprintf("%s != 0 || %s != 0", a, b)
+	}
+	// &, |, ^, == and <
+	return fmt.Sprintf("%s %s %s", a, op, b)
+}
+
+func (g *Generator) emit(format string, a ...interface{}) {
+	g.out.WriteString(fmt.Sprintf(format, a...))
+	g.out.WriteString("\n")
+}
@@ -0,0 +1,95 @@
+package cgen
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/toolchain"
+)
+
+func TestGenerate(t *testing.T) {
+	program, err := ir.Parse("[main]\n.L0:\n  ARGC r0\n  JMP .L1\n.L1:\n  IMM r1, -9223372036854775808\n  r2 = r0 + r1\n" +
+		"  BR r2, .L2, .L3\n.L2:\n  PUTS r2\n  JMP .L1\n.L3:\n  CALL r3, f(r0, r2)\n  RET r3\n" +
+		"[f]\n.L0:\n  STORE_ARG 0 a\n  STORE_ARG 1 b\n  BPREL r0, a\n  LOAD r1, [r0]\n  RET r1\n")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	source := New(program).Generate()
+
+	expected := []string{
+		"long long bee_main(void);\nlong long bee_f(long long p0, long long p1);\n",
+		"long long bee_main(void) {\n\tlong long r0;\n\tlong long r1;\n\tlong long r2;\n\tlong long r3;\n" +
+			"\tr0 = bee_argc();\nL1:;\n\tr1 = -9223372036854775807LL - 1;\n" +
+			"\tr2 = (long long)((unsigned long long)r0 + (unsigned long long)r1);\n" +
+			"\tif (r2) goto L2; else goto L3;\nL2:;\n\tprintf(\"%lld\\n\", r2);\n\tgoto L1;\n" +
+			"L3:;\n\tr3 = bee_f(r0, r2);\n\treturn r3;\n\treturn 0;\n}\n",
+		"long long bee_f(long long p0, long long p1) {\n\tlong long v0 = 0; /* a */\n\tlong long v1 = 0; /* b */\n",
+		"\tv0 = p0;\n\tv1 = p1;\n\tr0 = (long long)(intptr_t)&v0;\n\tr1 = *(long long *)(intptr_t)r0;\n",
+	}
+	for i, e := range expected {
+		if !strings.Contains(source, e) {
+			t.Errorf("[test-%d] %q is missing in\n%s", i, e, source)
+		}
+	}
+}
+
+// TestExecutables compares executables built from C with the VM
+func TestExecutables(t *testing.T) {
+	tc := toolchain.Default()
+	if _, err := exec.LookPath(tc.Compiler); err != nil {
+		t.Skipf("%s is not available", tc.Compiler)
+	}
+
+	tests := []testutil.Case{
+		{Input: "fn main() { return 42; }"},
+		{Input: "fn main() { puts 1 + 2 * 3; x = 7; y = 3; puts x / y; puts 0 - x / y; puts 0 - x % y; }"},
+		{Input: "fn main() { x = 7; y = 3; puts x & y; puts x | 8; puts x ^ y; puts ~x; puts x << y; puts 0 - x >> 1; puts !x; puts x == y; puts y < x; puts x && 0; puts 0 || y; }"},
+		{Input: "fn main() { x = 9223372036854775807; puts x + 1; y = 0 - 1; puts (x + 1) / y; puts (x + 1) % y; puts x * x; puts 1 << 65; }"},
+		{Input: "fn main() { i = 0; s = 0; while (i < 10) { s += i; i++; } return s; }"},
+		{Input: "fn main() { return fact(10) % 256; } fn fact(n) { if (n < 2) { return 1; } return n * fact(n - 1); }"},
+		{Input: "fn main() { return f(1, 2, 3) + g_h(4, 5); } fn f(a, b, c) { return a * 100 + b * 10 + c; } fn g_h(a, b) { return a - b; }"},
+		{Input: "fn main() { puts argc(); puts arg(0) + arg(1); }", Args: []string{"40", "0x2"}},
+		{Input: "fn main() { s = 0; x = gets(); while (!eof()) { s = s + x; x = gets(); } return s; }", Stdin: "1 2\n 3\n"},
+		// integers are read like strconv.ParseInt(s, 0, 64)
+		{Input: "fn main() { i = 0; while (i < argc()) { puts arg(i); i++; } puts gets(); puts gets(); }",
+			Args: []string{"0b101", "1_000", "0o17", "017", "-0x_1F", "+9223372036854775807", "-9223372036854775808"}, Stdin: "0B11 0o7_7\n"},
+		// runtime errors
+		{Input: "fn main() { x = 0; puts 1; return 1 / x; }"},
+		{Input: "fn main() { x = 0; return 1 % x; }"},
+		{Input: "fn main() { return arg(1); }", Args: []string{"1"}},
+		{Input: "fn main() { return arg(0); }", Args: []string{" 7"}},
+		{Input: "fn main() { return arg(0); }", Args: []string{"9223372036854775808"}},
+		{Input: "fn main() { return gets(); }", Stdin: "1__0"},
+	}
+
+	dir, err := ioutil.TempDir("", "bee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testutil.CompareExecutables(t, tests, func(t *testing.T, program *ir.Program, args []string, stdin string) (string, int64, error) {
+		return testutil.RunExecutable(t, build(t, dir, tc, program), args, stdin)
+	})
+}
+
+func build(t *testing.T, dir string, tc toolchain.Toolchain, program *ir.Program) string {
+	source := filepath.Join(dir, "program.c")
+	executable := filepath.Join(dir, "program")
+
+	if err := ioutil.WriteFile(source, []byte(New(program).Generate()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Compile(executable, source); err != nil {
+		t.Fatal(err)
+	}
+
+	return executable
+}
@@ -6,6 +6,20 @@ import (
 	"github.com/d2verb/bee/ast"
 )
 
+// builtins holds the number of parameters of each built-in function
+var builtins = map[string]int{
+	"argc": 0,
+	"arg":  1,
+	"gets": 0,
+	"eof":  0,
+}
+
+// IsBuiltin reports whether the function is a built-in function
+func IsBuiltin(functionName string) bool {
+	_, ok := builtins[functionName]
+	return ok
+}
+
 // Context represents context of semantic checker
 type Context struct {
 	function  *ast.Function
@@ -38,6 +52,12 @@ func (c *Checker) Check() {
 		return
 	}
 
+	c.checkEntryPoint()
+
+	if len(c.errors) != 0 {
+		return
+	}
+
 	for _, function := range c.program.Functions {
 		c.checkFunction(function)
 
@@ -77,6 +97,11 @@ func (c *Checker) checkStatement(node ast.Statement) {
 		c.checkWhileStatement(node)
 	case *ast.ExpressionStatement:
 		c.checkExpression(node.Expression)
+	case *ast.CompoundAssignStatement:
+		c.checkExpression(node.Target)
+		c.checkExpression(node.Value)
+	case *ast.IncDecStatement:
+		c.checkExpression(node.Target)
 	}
 }
 
@@ -142,7 +167,16 @@ func (c *Checker) Errors() []string {
 }
 
 func (c *Checker) checkFunctionSignature() {
+	for name, count := range builtins {
+		c.signatures[name] = count
+	}
+
 	for _, function := range c.program.Functions {
+		if IsBuiltin(function.Name) {
+			msg := fmt.Sprintf("function '%s' is a built-in function and cannot be redefined", function.Name)
+			c.errors = append(c.errors, msg)
+			return
+		}
 		if c.checkDuplicatedParameterExists(function) {
 			return
 		}
@@ -150,6 +184,17 @@ func (c *Checker) checkFunctionSignature() {
 	}
 }
 
+// checkEntryPoint checks that `main` exists and takes no parameters
+func (c *Checker) checkEntryPoint() {
+	if !c.isFunctionExists("main") {
+		c.errors = append(c.errors, "function 'main' is not defined")
+		return
+	}
+	if c.parameterCount("main") != 0 {
+		c.errors = append(c.errors, "function 'main' must not take any parameters")
+	}
+}
+
 func (c *Checker) checkDuplicatedParameterExists(function *ast.Function) bool {
 	parameters := map[string]struct{}{}
 	for _, parameter := range function.Parameters {
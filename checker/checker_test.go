@@ -48,6 +48,46 @@ func TestChecker(t *testing.T) {
 				"duplicated parameter 'x' in function 'main'",
 			},
 		},
+		{
+			"fn foo() { return 1; }",
+			[]string{
+				"function 'main' is not defined",
+			},
+		},
+		{
+			"fn main(x) { return x; }",
+			[]string{
+				"function 'main' must not take any parameters",
+			},
+		},
+		{
+			"fn main() { return arg(0) + argc(); }",
+			[]string{},
+		},
+		{
+			"fn main() { arg(); argc(1); }",
+			[]string{
+				"the number of arguments for 'arg' is not correct. expect=1, got=0",
+				"the number of arguments for 'argc' is not correct. expect=0, got=1",
+			},
+		},
+		{
+			"fn main() { x = 1; x += 2; x++; y -= x; z--; }",
+			[]string{
+				"variable 'y' is not defined",
+				"variable 'z' is not defined",
+			},
+		},
+		{
+			"fn main() { x = gets(); while (!eof()) { puts x; x = gets(); } }",
+			[]string{},
+		},
+		{
+			"fn main() {} fn arg(i) { return i; }",
+			[]string{
+				"function 'arg' is a built-in function and cannot be redefined",
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -76,7 +116,7 @@ func TestChecker(t *testing.T) {
 }
 
 func TestVariableCreation(t *testing.T) {
-	input := "fn main(x, y) { x = y; z = 6; x = z; s = z; }"
+	input := "fn foo(x, y) { x = y; z = 6; x = z; s = z; } fn main() {}"
 	l := lexer.New(input)
 	p := parser.New(l)
 
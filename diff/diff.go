@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change
+const context = 3
+
+// kind represents the kind of a line in an edit script
+type kind int
+
+const (
+	equal kind = iota
+	deleted
+	inserted
+)
+
+type edit struct {
+	kind kind
+	line string
+}
+
+// Unified returns the difference between a and b in unified diff format.
+// The result is empty if a and b are identical.
+func Unified(oldName string, newName string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+
+	edits := compute(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+
+	out.WriteString(fmt.Sprintf("--- %s\n", oldName))
+	out.WriteString(fmt.Sprintf("+++ %s\n", newName))
+
+	for start := 0; start < len(edits); {
+		// find the next change
+		for start < len(edits) && edits[start].kind == equal {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		// extend the hunk while changes are close to each other
+		first := max(start-context, 0)
+		last := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].kind != equal {
+				last = i
+			} else if i-last > 2*context {
+				break
+			}
+		}
+		end := min(last+context+1, len(edits))
+
+		writeHunk(&out, edits, first, end)
+
+		start = end
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *bytes.Buffer, edits []edit, first int, end int) {
+	oldStart, newStart := 1, 1
+	for _, e := range edits[:first] {
+		if e.kind != inserted {
+			oldStart++
+		}
+		if e.kind != deleted {
+			newStart++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, e := range edits[first:end] {
+		if e.kind != inserted {
+			oldCount++
+		}
+		if e.kind != deleted {
+			newCount++
+		}
+	}
+
+	// an empty range refers to the line before it
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+
+	out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+
+	for _, e := range edits[first:end] {
+		switch e.kind {
+		case equal:
+			out.WriteString(" ")
+		case deleted:
+			out.WriteString("-")
+		case inserted:
+			out.WriteString("+")
+		}
+		out.WriteString(e.line)
+		out.WriteString("\n")
+	}
+}
+
+// compute returns the shortest edit script from a to b based on the
+// longest common subsequence of lines
+func compute(a []string, b []string) []edit {
+	// lcs[i][j] holds the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{deleted, a[i]})
+			i++
+		default:
+			edits = append(edits, edit{inserted, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{deleted, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{inserted, b[j]})
+	}
+
+	return edits
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,36 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"a\nb\nc\n",
+			"a\nx\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			"",
+			"a\n",
+			"--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n12\n",
+			"--- old\n+++ new\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n" +
+				"@@ -8,5 +9,4 @@\n 8\n 9\n 10\n-11\n 12\n",
+		},
+	}
+
+	for i, tt := range tests {
+		actual := Unified("old", "new", tt.a, tt.b)
+		if actual != tt.expected {
+			t.Errorf("[test-%d] wrong diff. expected=\n%s\ngot=\n%s", i, tt.expected, actual)
+		}
+	}
+}
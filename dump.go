@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/d2verb/bee/dump"
+)
+
+// dumpCommand implements `bee dump [-ast|-ir] [-json] [optimizer flags] file`
+// and returns the exit status. The IR is dumped by default. Without -json the
+// debugging representation of the String methods is printed.
+func dumpCommand(args []string) int {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	dumpAST := flags.Bool("ast", false, "dump the checked AST")
+	dumpIR := flags.Bool("ir", false, "dump the optimized IR (default)")
+	asJSON := flags.Bool("json", false, "dump as JSON")
+	options := optimizerFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *dumpAST && *dumpIR {
+		fmt.Println("USAGE: bee dump [-ast|-ir] [-json] [optimizer flags] <file>")
+		return 1
+	}
+
+	filename := flags.Arg(0)
+
+	if *dumpAST {
+		program := parse(filename)
+		if !*asJSON {
+			fmt.Println(program.String())
+			return 0
+		}
+		return writeJSON(dump.AST(program))
+	}
+
+	irProgram := compile(filename, *options)
+	if !*asJSON {
+		fmt.Print(irProgram.String())
+		return 0
+	}
+	return writeJSON(dump.IR(irProgram))
+}
+
+func writeJSON(out []byte, err error) int {
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
@@ -0,0 +1,466 @@
+// Package dump serializes the AST and the IR into JSON for external tools.
+//
+// Every AST node is an object whose "type" field holds the name of the node
+// type (e.g. "InfixExpression") and whose "pos" field holds its position as
+// {"line": 1, "column": 1}. The position of an InfixExpression is that of its
+// operator. Identifiers refer to variables by the index into
+// "variables" of the enclosing function, or null if unresolved.
+//
+// Every IR instruction is an object whose "op" field holds the opcode
+// (e.g. "BINARY_OP"). Registers are referred to by their virtual number,
+// basic blocks by their label and variables by the index into "variables"
+// of the enclosing function. Instructions which carry a source position
+// (BINARY_OP with the position of its operator and CALL with that of the
+// call) have a "pos" field like AST nodes, which is null if the position is
+// unknown, e.g. for instructions created by the optimizer.
+//
+// The top-level objects have a "version" field which is incremented on
+// incompatible changes of the schema.
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// Version is the version of the JSON schema
+const Version = 1
+
+// object is a JSON object which keeps the order of its fields
+type object []field
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the fields in order
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+
+	return out.Bytes(), nil
+}
+
+// dumper contains the state while dumping a function
+type dumper struct {
+	variables map[*ast.Variable]int
+}
+
+// AST returns the JSON representation of the AST
+func AST(program *ast.Program) ([]byte, error) {
+	d := &dumper{}
+
+	functions := []interface{}{}
+	for _, function := range program.Functions {
+		functions = append(functions, d.function(function))
+	}
+
+	comments := []interface{}{}
+	for _, comment := range program.Comments {
+		comments = append(comments, object{
+			{"text", comment.Text},
+			{"pos", position(comment.Pos)},
+		})
+	}
+
+	return encode(object{
+		{"type", "Program"},
+		{"version", Version},
+		{"functions", functions},
+		{"comments", comments},
+	})
+}
+
+// IR returns the JSON representation of the IR
+func IR(program *ir.Program) ([]byte, error) {
+	d := &dumper{}
+
+	functions := []interface{}{}
+	for _, function := range program.Functions {
+		f, err := d.irFunction(function)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, f)
+	}
+
+	return encode(object{
+		{"version", Version},
+		{"functions", functions},
+	})
+}
+
+func encode(o object) ([]byte, error) {
+	out, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func (d *dumper) function(function *ast.Function) object {
+	variables := d.enterFunction(function)
+
+	parameters := []interface{}{}
+	for _, parameter := range function.Parameters {
+		parameters = append(parameters, d.variable(parameter))
+	}
+
+	return object{
+		{"type", "Function"},
+		{"pos", position(function.Pos)},
+		{"name", function.Name},
+		{"parameters", parameters},
+		{"variables", variables},
+		{"body", d.statement(function.Body)},
+	}
+}
+
+// enterFunction numbers the variables of function and returns their list
+func (d *dumper) enterFunction(function *ast.Function) []interface{} {
+	d.variables = make(map[*ast.Variable]int)
+
+	variables := []interface{}{}
+	for i, variable := range function.Variables {
+		d.variables[variable] = i
+		variables = append(variables, object{
+			{"name", variable.Name},
+			{"offset", variable.Offset},
+		})
+	}
+
+	return variables
+}
+
+// variable returns the index of variable in the current function
+func (d *dumper) variable(variable *ast.Variable) interface{} {
+	if i, ok := d.variables[variable]; ok {
+		return i
+	}
+	return nil
+}
+
+func (d *dumper) statement(node ast.Statement) interface{} {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if node == nil {
+			return nil
+		}
+		statements := []interface{}{}
+		for _, statement := range node.Statements {
+			statements = append(statements, d.statement(statement))
+		}
+		return object{
+			{"type", "BlockStatement"},
+			{"pos", position(node.Pos)},
+			{"end", position(node.End)},
+			{"statements", statements},
+		}
+	case *ast.ExpressionStatement:
+		return object{
+			{"type", "ExpressionStatement"},
+			{"pos", position(node.Pos)},
+			{"expression", d.expression(node.Expression)},
+		}
+	case *ast.ReturnStatement:
+		return object{
+			{"type", "ReturnStatement"},
+			{"pos", position(node.Pos)},
+			{"value", d.expression(node.Value)},
+		}
+	case *ast.PutsStatement:
+		return object{
+			{"type", "PutsStatement"},
+			{"pos", position(node.Pos)},
+			{"value", d.expression(node.Value)},
+		}
+	case *ast.IfStatement:
+		return object{
+			{"type", "IfStatement"},
+			{"pos", position(node.Pos)},
+			{"condition", d.expression(node.Condition)},
+			{"consequence", d.statement(node.Consequence)},
+			{"alternative", d.statement(node.Alternative)},
+		}
+	case *ast.WhileStatement:
+		return object{
+			{"type", "WhileStatement"},
+			{"pos", position(node.Pos)},
+			{"condition", d.expression(node.Condition)},
+			{"body", d.statement(node.Body)},
+		}
+	case *ast.CompoundAssignStatement:
+		return object{
+			{"type", "CompoundAssignStatement"},
+			{"pos", position(node.Pos)},
+			{"target", d.expression(node.Target)},
+			{"operator", node.Operator},
+			{"value", d.expression(node.Value)},
+		}
+	case *ast.IncDecStatement:
+		return object{
+			{"type", "IncDecStatement"},
+			{"pos", position(node.Pos)},
+			{"target", d.expression(node.Target)},
+			{"operator", node.Operator},
+		}
+	}
+	return nil
+}
+
+func (d *dumper) expression(node ast.Expression) interface{} {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		var variable interface{}
+		if node.Var != nil {
+			variable = d.variable(node.Var)
+		}
+		return object{
+			{"type", "Identifier"},
+			{"pos", position(node.Pos)},
+			{"name", node.Name},
+			{"variable", variable},
+		}
+	case *ast.IntegerLiteral:
+		return object{
+			{"type", "IntegerLiteral"},
+			{"pos", position(node.Pos)},
+			{"literal", node.Literal},
+			{"value", node.Value},
+		}
+	case *ast.CharLiteral:
+		return object{
+			{"type", "CharLiteral"},
+			{"pos", position(node.Pos)},
+			{"literal", node.Literal},
+			{"value", node.Value},
+		}
+	case *ast.PrefixExpression:
+		return object{
+			{"type", "PrefixExpression"},
+			{"pos", position(node.Pos)},
+			{"operator", node.Operator},
+			{"right", d.expression(node.Right)},
+		}
+	case *ast.InfixExpression:
+		return object{
+			{"type", "InfixExpression"},
+			{"pos", position(node.Pos)},
+			{"left", d.expression(node.Left)},
+			{"operator", node.Operator},
+			{"right", d.expression(node.Right)},
+		}
+	case *ast.CallExpression:
+		arguments := []interface{}{}
+		for _, argument := range node.Arguments {
+			arguments = append(arguments, d.expression(argument))
+		}
+		return object{
+			{"type", "CallExpression"},
+			{"pos", position(node.Pos)},
+			{"function", node.Function},
+			{"arguments", arguments},
+		}
+	}
+	return nil
+}
+
+func (d *dumper) irFunction(function *ir.Function) (object, error) {
+	variables := d.enterFunction(function.Node)
+
+	parameters := []interface{}{}
+	for _, parameter := range function.Node.Parameters {
+		parameters = append(parameters, d.variable(parameter))
+	}
+
+	blocks := []interface{}{}
+	for _, basicBlock := range function.BasicBlocks {
+		instructions := []interface{}{}
+		for _, instr := range basicBlock.Irs {
+			i, err := d.instruction(instr)
+			if err != nil {
+				return nil, err
+			}
+			instructions = append(instructions, i)
+		}
+
+		blocks = append(blocks, object{
+			{"label", basicBlock.Label},
+			{"succs", labels(basicBlock.Succs)},
+			{"preds", labels(basicBlock.Preds)},
+			{"instructions", instructions},
+		})
+	}
+
+	return object{
+		{"name", function.Node.Name},
+		{"parameters", parameters},
+		{"variables", variables},
+		{"blocks", blocks},
+	}, nil
+}
+
+func (d *dumper) instruction(instr ir.Ir) (object, error) {
+	switch instr := instr.(type) {
+	case *ir.BinaryOpIr:
+		return object{
+			{"op", "BINARY_OP"},
+			{"operator", instr.Operator},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+			{"r2", instr.R2.VirtualNo},
+			{"pos", optionalPosition(instr.Pos)},
+		}, nil
+	case *ir.UnaryOpIr:
+		return object{
+			{"op", "UNARY_OP"},
+			{"operator", instr.Operator},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+		}, nil
+	case *ir.BrIr:
+		return object{
+			{"op", "BR"},
+			{"r", instr.R.VirtualNo},
+			{"consequence", instr.Consequence.Label},
+			{"alternative", instr.Alternative.Label},
+		}, nil
+	case *ir.ImmIr:
+		return object{
+			{"op", "IMM"},
+			{"r", instr.R.VirtualNo},
+			{"value", instr.Value},
+		}, nil
+	case *ir.JmpIr:
+		return object{
+			{"op", "JMP"},
+			{"target", instr.Target.Label},
+		}, nil
+	case *ir.PutsIr:
+		return object{
+			{"op", "PUTS"},
+			{"r", instr.R.VirtualNo},
+		}, nil
+	case *ir.GetsIr:
+		return object{
+			{"op", "GETS"},
+			{"r", instr.R.VirtualNo},
+		}, nil
+	case *ir.EofIr:
+		return object{
+			{"op", "EOF"},
+			{"r", instr.R.VirtualNo},
+		}, nil
+	case *ir.ArgcIr:
+		return object{
+			{"op", "ARGC"},
+			{"r", instr.R.VirtualNo},
+		}, nil
+	case *ir.ArgIr:
+		return object{
+			{"op", "ARG"},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+		}, nil
+	case *ir.RetIr:
+		return object{
+			{"op", "RET"},
+			{"r", instr.R.VirtualNo},
+		}, nil
+	case *ir.CallIr:
+		arguments := []interface{}{}
+		for _, r := range instr.Arguments {
+			arguments = append(arguments, r.VirtualNo)
+		}
+		return object{
+			{"op", "CALL"},
+			{"function", instr.Function},
+			{"return", instr.Return.VirtualNo},
+			{"arguments", arguments},
+			{"pos", optionalPosition(instr.Pos)},
+		}, nil
+	case *ir.BprelIr:
+		return object{
+			{"op", "BPREL"},
+			{"r", instr.R.VirtualNo},
+			{"variable", d.variable(instr.Var)},
+		}, nil
+	case *ir.LoadIr:
+		return object{
+			{"op", "LOAD"},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+		}, nil
+	case *ir.StoreIr:
+		return object{
+			{"op", "STORE"},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+		}, nil
+	case *ir.StoreArgIr:
+		return object{
+			{"op", "STORE_ARG"},
+			{"index", instr.Index},
+			{"variable", d.variable(instr.Var)},
+		}, nil
+	case *ir.MovIr:
+		return object{
+			{"op", "MOV"},
+			{"r0", instr.R0.VirtualNo},
+			{"r1", instr.R1.VirtualNo},
+		}, nil
+	case *ir.NopIr:
+		return object{
+			{"op", "NOP"},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown instruction: %s", instr.String())
+}
+
+func labels(basicBlocks []*ir.BasicBlock) []int {
+	labels := []int{}
+	for _, basicBlock := range basicBlocks {
+		labels = append(labels, basicBlock.Label)
+	}
+	return labels
+}
+
+func position(pos token.Position) object {
+	return object{
+		{"line", pos.Line},
+		{"column", pos.Column},
+	}
+}
+
+// optionalPosition returns the position of an instruction, or nil if the
+// position is unknown
+func optionalPosition(pos token.Position) interface{} {
+	if pos.Line == 0 {
+		return nil
+	}
+	return position(pos)
+}
@@ -0,0 +1,137 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/checker"
+	"github.com/d2verb/bee/generator"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/lexer"
+	"github.com/d2verb/bee/parser"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.bee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		program := parse(t, file)
+
+		astJSON, err := AST(program)
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		irJSON, err := IR(generator.New(program).Generate())
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		compareGolden(t, file[:len(file)-len(".bee")]+".ast.json", astJSON)
+		compareGolden(t, file[:len(file)-len(".bee")]+".ir.json", irJSON)
+	}
+}
+
+func TestValidJSON(t *testing.T) {
+	program := parse(t, filepath.Join("testdata", "program.bee"))
+
+	astJSON, err := AST(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(astJSON, &decoded); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	if decoded["type"] != "Program" || decoded["version"] != float64(Version) {
+		t.Errorf("wrong top-level object: type=%v, version=%v", decoded["type"], decoded["version"])
+	}
+}
+
+func TestUnknownPosition(t *testing.T) {
+	program, err := ir.Parse("[main]\n.L0:\n  IMM r0, 1\n  r1 = r0 + r0\n  CALL r2, main()\n  RET r1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	irJSON, err := IR(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Functions []struct {
+			Blocks []struct {
+				Instructions []map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(irJSON, &decoded); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	for _, instr := range decoded.Functions[0].Blocks[0].Instructions {
+		pos, ok := instr["pos"]
+		switch instr["op"] {
+		case "BINARY_OP", "CALL":
+			if !ok || pos != nil {
+				t.Errorf("%s: expected \"pos\": null, got=%v (present=%t)", instr["op"], pos, ok)
+			}
+		default:
+			if ok {
+				t.Errorf("%s: unexpected \"pos\" field", instr["op"])
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, file string) *ast.Program {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("%s: parser errors: %q", file, errors)
+	}
+
+	c := checker.New(program)
+	c.Check()
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("%s: checker errors: %q", file, errors)
+	}
+
+	return program
+}
+
+func compareGolden(t *testing.T, golden string, actual []byte) {
+	if *update {
+		if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%s (run `go test ./dump -update` to create it)", err)
+	}
+
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s does not match. got=\n%s", golden, actual)
+	}
+}
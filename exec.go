@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/d2verb/bee/bytecode"
+)
+
+// execUsage is also printed by `bee` without arguments
+const execUsage = "bee exec [-d] <file.beec> [arguments...]"
+
+// execCommand implements `bee exec` and returns the exit status. It runs a
+// .beec file written by `bee build -emit-bytecode` on the bytecode machine,
+// or prints its disassembly with -d.
+func execCommand(args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	disassemble := flags.Bool("d", false, "print the disassembly instead of running the program")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		fmt.Println("USAGE: " + execUsage)
+		return 1
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+	defer file.Close()
+
+	program, err := bytecode.Decode(file)
+	if err != nil {
+		fmt.Printf("bee exec: %s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	if *disassemble {
+		fmt.Print(program.String())
+		return 0
+	}
+
+	exitCode, err := bytecode.NewMachine(program, flags.Args()[1:], os.Stdin, os.Stdout).Run()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return 1
+	}
+
+	// the exit status of the process mirrors the return value of main
+	return int(exitCode)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/d2verb/bee/diff"
+	"github.com/d2verb/bee/printer"
+)
+
+// formatCommand implements `bee fmt [-w] [-d] files...` and returns the exit
+// status. With -d the status is 1 if any file is not formatted, so that it
+// can be used in CI.
+func formatCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to source files instead of stdout")
+	showDiff := flags.Bool("d", false, "display diffs instead of formatted sources")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("USAGE: bee fmt [-w] [-d] <file>...")
+		return 1
+	}
+
+	exitCode := 0
+
+	for _, filename := range flags.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			exitCode = 1
+			continue
+		}
+
+		formatted, err := printer.Source(src)
+		if err != nil {
+			fmt.Printf("%s: %s\n", filename, err)
+			exitCode = 1
+			continue
+		}
+
+		if *showDiff {
+			if d := diff.Unified(filename+".orig", filename, string(src), string(formatted)); d != "" {
+				fmt.Print(d)
+				exitCode = 1
+			}
+		}
+
+		if *write {
+			if bytes.Equal(src, formatted) {
+				continue
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				fmt.Println("Error: ", err)
+				exitCode = 1
+				continue
+			}
+			if err := ioutil.WriteFile(filename, formatted, info.Mode()); err != nil {
+				fmt.Println("Error: ", err)
+				exitCode = 1
+			}
+		}
+
+		if !*showDiff && !*write {
+			os.Stdout.Write(formatted)
+		}
+	}
+
+	return exitCode
+}
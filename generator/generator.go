@@ -3,6 +3,7 @@ package generator
 import (
 	"github.com/d2verb/bee/ast"
 	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
 )
 
 // IrGenerator represents IR generator and contains internal state
@@ -44,6 +45,11 @@ func (ig *IrGenerator) Generate() *ir.Program {
 		// always return 0 at the end of function
 		ig.ret(ig.imm(0))
 
+		// drop the empty basic block opened by the last RET
+		ig.function.BasicBlocks = ig.function.BasicBlocks[:len(ig.function.BasicBlocks)-1]
+
+		ir.BuildCFG(ig.function)
+
 		program.Functions = append(program.Functions, ig.function)
 	}
 
@@ -93,6 +99,15 @@ func (ig *IrGenerator) generateStatement(node ast.Statement) {
 		ig.setCurrentBasicBlock(last)
 	case *ast.ExpressionStatement:
 		ig.generateExpression(node.Expression)
+	case *ast.CompoundAssignStatement:
+		// the target address is computed once and used for both load and store
+		to := ig.generateAddress(node.Target)
+		value := ig.binop(node.Operator[:1], ig.load(to), ig.generateExpression(node.Value), node.Pos)
+		ig.store(to, value)
+	case *ast.IncDecStatement:
+		to := ig.generateAddress(node.Target)
+		value := ig.binop(node.Operator[:1], ig.load(to), ig.imm(1), node.Pos)
+		ig.store(to, value)
 	case *ast.PutsStatement:
 		r := ig.generateExpression(node.Value)
 		ig.puts(r)
@@ -110,21 +125,34 @@ func (ig *IrGenerator) generateExpression(node ast.Expression) *ir.Register {
 	switch node := node.(type) {
 	case *ast.IntegerLiteral:
 		return ig.imm(node.Value)
+	case *ast.CharLiteral:
+		return ig.imm(int64(node.Value))
 	case *ast.CallExpression:
+		switch node.Function {
+		case "argc":
+			return ig.argc()
+		case "arg":
+			return ig.arg(ig.generateExpression(node.Arguments[0]))
+		case "gets":
+			return ig.gets()
+		case "eof":
+			return ig.eof()
+		}
 		arguments := []*ir.Register{}
 		for _, argument := range node.Arguments {
 			arguments = append(arguments, ig.generateExpression(argument))
 		}
-		return ig.call(node.Function, arguments)
+		return ig.call(node.Function, arguments, node.Pos)
 	case *ast.InfixExpression:
 		if node.Operator == "=" {
 			from := ig.generateExpression(node.Right)
-			to := ig.bprel(node.Left.(*ast.Identifier).Var)
+			to := ig.generateAddress(node.Left)
 			return ig.store(to, from)
 		}
 		return ig.binop(node.Operator,
 			ig.generateExpression(node.Left),
-			ig.generateExpression(node.Right))
+			ig.generateExpression(node.Right),
+			node.Pos)
 	case *ast.PrefixExpression:
 		return ig.unary(node.Operator, ig.generateExpression(node.Right))
 	case *ast.Identifier:
@@ -133,6 +161,16 @@ func (ig *IrGenerator) generateExpression(node ast.Expression) *ir.Register {
 	return nil
 }
 
+// generateAddress generates IR which calculates the address of an assignable
+// expression
+func (ig *IrGenerator) generateAddress(node ast.Expression) *ir.Register {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return ig.bprel(node.Var)
+	}
+	return nil
+}
+
 func (ig *IrGenerator) storeArg(index int, variable *ast.Variable) {
 	ir := &ir.StoreArgIr{
 		Index: index,
@@ -178,27 +216,62 @@ func (ig *IrGenerator) unary(op string, r1 *ir.Register) *ir.Register {
 	return ir.R0
 }
 
-func (ig *IrGenerator) binop(op string, r1 *ir.Register, r2 *ir.Register) *ir.Register {
+func (ig *IrGenerator) binop(op string, r1 *ir.Register, r2 *ir.Register, pos token.Position) *ir.Register {
 	ir := &ir.BinaryOpIr{
 		Operator: op,
 		R0:       ig.newRegister(),
 		R1:       r1,
 		R2:       r2,
+		Pos:      pos,
 	}
 	ig.out.Irs = append(ig.out.Irs, ir)
 	return ir.R0
 }
 
-func (ig *IrGenerator) call(function string, rs []*ir.Register) *ir.Register {
+func (ig *IrGenerator) call(function string, rs []*ir.Register, pos token.Position) *ir.Register {
 	ir := &ir.CallIr{
 		Function:  function,
 		Arguments: rs,
 		Return:    ig.newRegister(),
+		Pos:       pos,
 	}
 	ig.out.Irs = append(ig.out.Irs, ir)
 	return ir.Return
 }
 
+func (ig *IrGenerator) argc() *ir.Register {
+	ir := &ir.ArgcIr{
+		R: ig.newRegister(),
+	}
+	ig.out.Irs = append(ig.out.Irs, ir)
+	return ir.R
+}
+
+func (ig *IrGenerator) arg(index *ir.Register) *ir.Register {
+	ir := &ir.ArgIr{
+		R0: ig.newRegister(),
+		R1: index,
+	}
+	ig.out.Irs = append(ig.out.Irs, ir)
+	return ir.R0
+}
+
+func (ig *IrGenerator) gets() *ir.Register {
+	ir := &ir.GetsIr{
+		R: ig.newRegister(),
+	}
+	ig.out.Irs = append(ig.out.Irs, ir)
+	return ir.R
+}
+
+func (ig *IrGenerator) eof() *ir.Register {
+	ir := &ir.EofIr{
+		R: ig.newRegister(),
+	}
+	ig.out.Irs = append(ig.out.Irs, ir)
+	return ir.R
+}
+
 func (ig *IrGenerator) br(r *ir.Register, consequence *ir.BasicBlock, alternative *ir.BasicBlock) ir.Ir {
 	ir := &ir.BrIr{
 		R:           r,
@@ -0,0 +1,144 @@
+// Package testutil provides helpers shared by the tests of the VM and the
+// backends: compiling source through the whole pipeline and comparing the
+// behavior of a backend with the VM.
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/checker"
+	"github.com/d2verb/bee/generator"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/lexer"
+	"github.com/d2verb/bee/optimizer"
+	"github.com/d2verb/bee/parser"
+	"github.com/d2verb/bee/vm"
+)
+
+// Compile parses, checks and generates the IR of input and optimizes it at
+// level with the IR verified after every pass. Errors fail the test.
+func Compile(t testing.TB, input string, level int) *ir.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %v", errors)
+	}
+
+	c := checker.New(program)
+	c.Check()
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("checker errors: %v", errors)
+	}
+
+	irProgram := generator.New(program).Generate()
+	if err := optimizer.Optimize(irProgram, optimizer.Options{Level: level, VerifyIR: true}); err != nil {
+		t.Fatalf("optimizer error: %s", err)
+	}
+
+	return irProgram
+}
+
+// Case is a program with its command-line arguments and input
+type Case struct {
+	Input string
+	Args  []string
+	Stdin string
+}
+
+// Runner runs program with a backend and returns its output, its exit code
+// and its runtime error, if any
+type Runner func(t *testing.T, program *ir.Program, args []string, stdin string) (string, int64, error)
+
+// CompareWithVM runs every case at every optimization level with run and
+// with the VM, and reports differences in the output, the exit code and the
+// runtime error
+func CompareWithVM(t *testing.T, tests []Case, run Runner) {
+	t.Helper()
+	compare(t, tests, run, false)
+}
+
+// CompareExecutables is like CompareWithVM for runners of executables, which
+// return what is printed to stderr as the error. Exit codes are compared as
+// exit statuses of 8 bits, and runtime errors of the VM are expected to be
+// printed like `Error: division by zero` with status 1. Cases for which the
+// VM overflows the stack are skipped, since executables do not share its
+// limit of the depth of calls.
+func CompareExecutables(t *testing.T, tests []Case, run Runner) {
+	t.Helper()
+	compare(t, tests, run, true)
+}
+
+// RunExecutable runs executable with args and stdin, and returns its output,
+// its exit status and what it prints to stderr as the error like a Runner
+func RunExecutable(t *testing.T, executable string, args []string, stdin string) (string, int64, error) {
+	t.Helper()
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(executable, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	code := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("failed to run the executable: %s", err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	if stderr.Len() != 0 {
+		return out.String(), int64(code), errors.New(stderr.String())
+	}
+	return out.String(), int64(code), nil
+}
+
+func compare(t *testing.T, tests []Case, run Runner, executable bool) {
+	t.Helper()
+
+	for i, tt := range tests {
+		for level := 0; level <= 2; level++ {
+			program := Compile(t, tt.Input, level)
+
+			var expected bytes.Buffer
+			expectedCode, expectedErr := vm.New(program, tt.Args, strings.NewReader(tt.Stdin), &expected).Run()
+			if executable && expectedErr != nil && strings.HasPrefix(expectedErr.Error(), "stack overflow") {
+				continue
+			}
+
+			output, code, err := run(t, program, tt.Args, tt.Stdin)
+			if executable {
+				expectedCode = int64(uint8(expectedCode))
+				if expectedErr != nil {
+					expectedErr = errors.New("Error: " + expectedErr.Error() + "\n")
+					expectedCode = 1
+				}
+			}
+
+			if (err == nil) != (expectedErr == nil) || err != nil && err.Error() != expectedErr.Error() {
+				t.Errorf("[test-%d] -O%d: wrong error. expected=%q, got=%q", i, level, errorString(expectedErr), errorString(err))
+			}
+			if output != expected.String() {
+				t.Errorf("[test-%d] -O%d: wrong output. expected=%q, got=%q", i, level, expected.String(), output)
+			}
+			if code != expectedCode {
+				t.Errorf("[test-%d] -O%d: wrong exit code. expected=%d, got=%d", i, level, expectedCode, code)
+			}
+		}
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
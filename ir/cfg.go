@@ -0,0 +1,231 @@
+package ir
+
+import (
+	"sort"
+)
+
+// Successors returns the basic blocks which the terminator of bb may jump to
+func Successors(bb *BasicBlock) []*BasicBlock {
+	if len(bb.Irs) == 0 {
+		return nil
+	}
+
+	switch instr := bb.Irs[len(bb.Irs)-1].(type) {
+	case *JmpIr:
+		return []*BasicBlock{instr.Target}
+	case *BrIr:
+		if instr.Consequence == instr.Alternative {
+			return []*BasicBlock{instr.Consequence}
+		}
+		return []*BasicBlock{instr.Consequence, instr.Alternative}
+	}
+	return nil
+}
+
+// BuildCFG sets Succs and Preds of all basic blocks of function from their
+// terminators. It must be called again whenever a pass changes the control
+// flow.
+func BuildCFG(function *Function) {
+	for _, bb := range function.BasicBlocks {
+		bb.Succs = []*BasicBlock{}
+		bb.Preds = []*BasicBlock{}
+	}
+
+	for _, bb := range function.BasicBlocks {
+		for _, succ := range Successors(bb) {
+			bb.Succs = append(bb.Succs, succ)
+			succ.Preds = append(succ.Preds, bb)
+		}
+	}
+}
+
+// ReversePostorder returns the basic blocks reachable from the entry block
+// in reverse postorder of a depth-first search
+func ReversePostorder(function *Function) []*BasicBlock {
+	if len(function.BasicBlocks) == 0 {
+		return nil
+	}
+
+	visited := make(map[*BasicBlock]bool)
+	postorder := []*BasicBlock{}
+
+	var visit func(bb *BasicBlock)
+	visit = func(bb *BasicBlock) {
+		visited[bb] = true
+		for _, succ := range bb.Succs {
+			if !visited[succ] {
+				visit(succ)
+			}
+		}
+		postorder = append(postorder, bb)
+	}
+	visit(function.BasicBlocks[0])
+
+	order := make([]*BasicBlock, len(postorder))
+	for i, bb := range postorder {
+		order[len(postorder)-1-i] = bb
+	}
+	return order
+}
+
+// Dominators represents the dominator tree of a function.
+// Only blocks reachable from the entry block are in the tree.
+type Dominators struct {
+	entry    *BasicBlock
+	idom     map[*BasicBlock]*BasicBlock
+	children map[*BasicBlock][]*BasicBlock
+	order    map[*BasicBlock]int
+}
+
+// ComputeDominators computes the dominator tree of function with the
+// algorithm of Cooper, Harvey and Kennedy. Succs and Preds must be up to
+// date.
+func ComputeDominators(function *Function) *Dominators {
+	blocks := ReversePostorder(function)
+
+	d := &Dominators{
+		idom:     make(map[*BasicBlock]*BasicBlock),
+		children: make(map[*BasicBlock][]*BasicBlock),
+		order:    make(map[*BasicBlock]int),
+	}
+	if len(blocks) == 0 {
+		return d
+	}
+
+	for i, bb := range blocks {
+		d.order[bb] = i
+	}
+
+	d.entry = blocks[0]
+	d.idom[d.entry] = d.entry
+
+	for changed := true; changed; {
+		changed = false
+		for _, bb := range blocks[1:] {
+			var idom *BasicBlock
+			for _, pred := range bb.Preds {
+				if _, ok := d.idom[pred]; !ok {
+					continue
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = d.intersect(pred, idom)
+				}
+			}
+			if d.idom[bb] != idom {
+				d.idom[bb] = idom
+				changed = true
+			}
+		}
+	}
+
+	for _, bb := range blocks[1:] {
+		d.children[d.idom[bb]] = append(d.children[d.idom[bb]], bb)
+	}
+
+	return d
+}
+
+func (d *Dominators) intersect(a *BasicBlock, b *BasicBlock) *BasicBlock {
+	for a != b {
+		for d.order[a] > d.order[b] {
+			a = d.idom[a]
+		}
+		for d.order[b] > d.order[a] {
+			b = d.idom[b]
+		}
+	}
+	return a
+}
+
+// Idom returns the immediate dominator of bb, or nil for the entry block
+// and unreachable blocks
+func (d *Dominators) Idom(bb *BasicBlock) *BasicBlock {
+	if bb == d.entry {
+		return nil
+	}
+	return d.idom[bb]
+}
+
+// Children returns the blocks immediately dominated by bb
+func (d *Dominators) Children(bb *BasicBlock) []*BasicBlock {
+	return d.children[bb]
+}
+
+// Reachable reports whether bb is reachable from the entry block
+func (d *Dominators) Reachable(bb *BasicBlock) bool {
+	_, ok := d.idom[bb]
+	return ok
+}
+
+// Dominates reports whether every path from the entry block to b passes
+// through a. A block dominates itself.
+func (d *Dominators) Dominates(a *BasicBlock, b *BasicBlock) bool {
+	if !d.Reachable(a) || !d.Reachable(b) {
+		return false
+	}
+	for {
+		if a == b {
+			return true
+		}
+		if b == d.entry {
+			return false
+		}
+		b = d.idom[b]
+	}
+}
+
+// Loop represents a natural loop
+type Loop struct {
+	Header  *BasicBlock
+	Blocks  map[*BasicBlock]bool
+	Latches []*BasicBlock // blocks with a back edge to Header
+}
+
+// FindLoops returns the natural loops of function, one per header, ordered
+// from inner to outer loops. A back edge is an edge whose target dominates
+// its source.
+func FindLoops(function *Function, dominators *Dominators) []*Loop {
+	loops := []*Loop{}
+	byHeader := make(map[*BasicBlock]*Loop)
+
+	for _, bb := range ReversePostorder(function) {
+		for _, succ := range bb.Succs {
+			if !dominators.Dominates(succ, bb) {
+				continue
+			}
+
+			loop, ok := byHeader[succ]
+			if !ok {
+				loop = &Loop{
+					Header: succ,
+					Blocks: map[*BasicBlock]bool{succ: true},
+				}
+				byHeader[succ] = loop
+				loops = append(loops, loop)
+			}
+			loop.Latches = append(loop.Latches, bb)
+
+			// the loop consists of the blocks reaching the latch without
+			// passing through the header
+			stack := []*BasicBlock{bb}
+			for len(stack) > 0 {
+				next := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if loop.Blocks[next] || !dominators.Reachable(next) {
+					continue
+				}
+				loop.Blocks[next] = true
+				stack = append(stack, next.Preds...)
+			}
+		}
+	}
+
+	// inner loops have fewer blocks than the loops containing them
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].Blocks) < len(loops[j].Blocks)
+	})
+
+	return loops
+}
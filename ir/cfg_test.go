@@ -0,0 +1,103 @@
+package ir
+
+import (
+	"testing"
+)
+
+// nested loops
+//
+//	.L0 -> .L1 -> .L2 -> .L3 -> .L2
+//	              .L2 -> .L4 -> .L1
+//	       .L1 -> .L5
+const nestedLoops = `[main]
+.L0:
+  ARGC r0
+  JMP .L1
+.L1:
+  BR r0, .L2, .L5
+.L2:
+  BR r0, .L3, .L4
+.L3:
+  JMP .L2
+.L4:
+  JMP .L1
+.L5:
+  RET r0
+.L6:
+  JMP .L1
+`
+
+func TestDominators(t *testing.T) {
+	program, err := Parse(nestedLoops)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	blocks := program.Functions[0].BasicBlocks
+
+	d := ComputeDominators(program.Functions[0])
+
+	idoms := []int{-1, 0, 1, 2, 2, 1, -1}
+	for i, expected := range idoms {
+		idom := d.Idom(blocks[i])
+		if expected < 0 {
+			if idom != nil {
+				t.Errorf("idom of .L%d should be nil, got .L%d", i, idom.Label)
+			}
+			continue
+		}
+		if idom != blocks[expected] {
+			t.Errorf("wrong idom of .L%d. expected=.L%d, got=%v", i, expected, idom)
+		}
+	}
+
+	if !d.Dominates(blocks[1], blocks[3]) || d.Dominates(blocks[3], blocks[4]) {
+		t.Errorf("wrong dominance")
+	}
+	if d.Reachable(blocks[6]) || d.Dominates(blocks[0], blocks[6]) {
+		t.Errorf(".L6 should be unreachable")
+	}
+	if len(d.Children(blocks[1])) != 2 {
+		t.Errorf("wrong children of .L1: %v", d.Children(blocks[1]))
+	}
+}
+
+func TestFindLoops(t *testing.T) {
+	program, err := Parse(nestedLoops)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	function := program.Functions[0]
+	blocks := function.BasicBlocks
+
+	loops := FindLoops(function, ComputeDominators(function))
+	if len(loops) != 2 {
+		t.Fatalf("wrong number of loops. expected=2, got=%d", len(loops))
+	}
+
+	tests := []struct {
+		header int
+		blocks []int
+		latch  int
+	}{
+		{2, []int{2, 3}, 3},
+		{1, []int{1, 2, 3, 4}, 4},
+	}
+
+	for i, tt := range tests {
+		loop := loops[i]
+		if loop.Header != blocks[tt.header] {
+			t.Errorf("[test-%d] wrong header. expected=.L%d, got=.L%d", i, tt.header, loop.Header.Label)
+		}
+		if len(loop.Blocks) != len(tt.blocks) {
+			t.Errorf("[test-%d] wrong number of blocks. expected=%d, got=%d", i, len(tt.blocks), len(loop.Blocks))
+		}
+		for _, b := range tt.blocks {
+			if !loop.Blocks[blocks[b]] {
+				t.Errorf("[test-%d] .L%d should be in the loop", i, b)
+			}
+		}
+		if len(loop.Latches) != 1 || loop.Latches[0] != blocks[tt.latch] {
+			t.Errorf("[test-%d] wrong latches: %v", i, loop.Latches)
+		}
+	}
+}
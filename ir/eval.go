@@ -0,0 +1,70 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDivisionByZero is returned for division and modulo by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+// EvalBinary computes `lhs op rhs`. Arithmetic wraps around on overflow
+// (so math.MinInt64 / -1 is math.MinInt64), only the low 6 bits of shift
+// counts are used, and comparisons and logical operators yield 0 or 1.
+func EvalBinary(op string, lhs int64, rhs int64) (int64, error) {
+	switch op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	case "/":
+		if rhs == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return lhs / rhs, nil
+	case "%":
+		if rhs == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return lhs % rhs, nil
+	case "&":
+		return lhs & rhs, nil
+	case "|":
+		return lhs | rhs, nil
+	case "^":
+		return lhs ^ rhs, nil
+	case "<<":
+		return lhs << (uint64(rhs) & 63), nil
+	case ">>":
+		return lhs >> (uint64(rhs) & 63), nil
+	case "==":
+		return boolToInt(lhs == rhs), nil
+	case "<":
+		return boolToInt(lhs < rhs), nil
+	case "&&":
+		return boolToInt(lhs != 0 && rhs != 0), nil
+	case "||":
+		return boolToInt(lhs != 0 || rhs != 0), nil
+	}
+	return 0, fmt.Errorf("unknown binary operator: %s", op)
+}
+
+// EvalUnary computes `op value`
+func EvalUnary(op string, value int64) (int64, error) {
+	switch op {
+	case "!":
+		return boolToInt(value == 0), nil
+	case "~":
+		return ^value, nil
+	}
+	return 0, fmt.Errorf("unknown unary operator: %s", op)
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package ir
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvalBinary(t *testing.T) {
+	tests := []struct {
+		op       string
+		lhs      int64
+		rhs      int64
+		expected int64
+		err      error
+	}{
+		{"+", 1, 2, 3, nil},
+		{"+", math.MaxInt64, 1, math.MinInt64, nil},
+		{"-", math.MinInt64, 1, math.MaxInt64, nil},
+		{"*", math.MaxInt64, 2, -2, nil},
+		{"/", 7, -2, -3, nil},
+		{"/", math.MinInt64, -1, math.MinInt64, nil},
+		{"/", 1, 0, 0, ErrDivisionByZero},
+		{"%", -7, 2, -1, nil},
+		{"%", math.MinInt64, -1, 0, nil},
+		{"%", 1, 0, 0, ErrDivisionByZero},
+		{"&", 6, 3, 2, nil},
+		{"|", 6, 3, 7, nil},
+		{"^", 6, 3, 5, nil},
+		{"<<", 1, 4, 16, nil},
+		{"<<", 1, 65, 2, nil},
+		{">>", -8, 1, -4, nil},
+		{">>", 8, -1, 0, nil},
+		{"==", 2, 2, 1, nil},
+		{"==", 2, 3, 0, nil},
+		{"<", 2, 3, 1, nil},
+		{"<", 3, 2, 0, nil},
+		{"&&", 2, 3, 1, nil},
+		{"&&", 2, 0, 0, nil},
+		{"||", 0, 3, 1, nil},
+		{"||", 0, 0, 0, nil},
+	}
+
+	for i, tt := range tests {
+		result, err := EvalBinary(tt.op, tt.lhs, tt.rhs)
+		if err != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%v, got=%v", i, tt.err, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("[test-%d] wrong result of %d %s %d. expected=%d, got=%d", i, tt.lhs, tt.op, tt.rhs, tt.expected, result)
+		}
+	}
+
+	if _, err := EvalBinary("?", 1, 2); err == nil {
+		t.Errorf("expected error for unknown operator")
+	}
+}
+
+func TestEvalUnary(t *testing.T) {
+	tests := []struct {
+		op       string
+		value    int64
+		expected int64
+	}{
+		{"!", 0, 1},
+		{"!", 5, 0},
+		{"~", 5, -6},
+		{"~", math.MinInt64, math.MaxInt64},
+	}
+
+	for i, tt := range tests {
+		result, err := EvalUnary(tt.op, tt.value)
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("[test-%d] wrong result of %s%d. expected=%d, got=%d", i, tt.op, tt.value, tt.expected, result)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/token"
 )
 
 // Ir is the interface for all intermediate representation
@@ -73,12 +74,14 @@ func (bb *BasicBlock) String() string {
 	return out.String()
 }
 
-// BinaryOpIr represents `r0 = r1 OP r2`
+// BinaryOpIr represents `r0 = r1 OP r2`.
+// Pos is the position of the operator in the source, if any.
 type BinaryOpIr struct {
 	Operator string
 	R0       *Register
 	R1       *Register
 	R2       *Register
+	Pos      token.Position
 }
 
 func (ir *BinaryOpIr) ir() {}
@@ -145,6 +148,48 @@ func (ir *PutsIr) String() string {
 	return fmt.Sprintf("PUTS r%d", ir.R.VirtualNo)
 }
 
+// ArgcIr represents `ARGC r` to get the number of command-line arguments
+type ArgcIr struct {
+	R *Register
+}
+
+func (ir *ArgcIr) ir() {}
+func (ir *ArgcIr) String() string {
+	return fmt.Sprintf("ARGC r%d", ir.R.VirtualNo)
+}
+
+// ArgIr represents `ARG r0, r1` to get the command-line argument at index r1
+// parsed as an integer
+type ArgIr struct {
+	R0 *Register
+	R1 *Register
+}
+
+func (ir *ArgIr) ir() {}
+func (ir *ArgIr) String() string {
+	return fmt.Sprintf("ARG r%d, r%d", ir.R0.VirtualNo, ir.R1.VirtualNo)
+}
+
+// GetsIr represents `GETS r` to read an integer from standard input
+type GetsIr struct {
+	R *Register
+}
+
+func (ir *GetsIr) ir() {}
+func (ir *GetsIr) String() string {
+	return fmt.Sprintf("GETS r%d", ir.R.VirtualNo)
+}
+
+// EofIr represents `EOF r` to check whether GETS has reached the end of input
+type EofIr struct {
+	R *Register
+}
+
+func (ir *EofIr) ir() {}
+func (ir *EofIr) String() string {
+	return fmt.Sprintf("EOF r%d", ir.R.VirtualNo)
+}
+
 // RetIr represents `RET r`
 type RetIr struct {
 	R *Register
@@ -155,26 +200,24 @@ func (ir *RetIr) String() string {
 	return fmt.Sprintf("RET r%d", ir.R.VirtualNo)
 }
 
-// CallIr represents `CALL r0 r1 r2 ...`
+// CallIr represents `CALL r0, f(r1, r2, ...)`, which stores the return value
+// of f in r0. Pos is the position of the call in the source, if any.
 type CallIr struct {
 	Function  string
 	Return    *Register
 	Arguments []*Register
+	Pos       token.Position
 }
 
 func (ir *CallIr) ir() {}
 func (ir *CallIr) String() string {
-	var out bytes.Buffer
-
-	out.WriteString(fmt.Sprintf("CALL %s ", ir.Function))
-
 	rs := []string{}
 	for _, r := range ir.Arguments {
 		rs = append(rs, fmt.Sprintf("r%d", r.VirtualNo))
 	}
-	out.WriteString(strings.Join(rs, ", "))
 
-	return out.String()
+	return fmt.Sprintf("CALL r%d, %s(%s)",
+		ir.Return.VirtualNo, ir.Function, strings.Join(rs, ", "))
 }
 
 // BprelIr represents `BPREL r rbp - var.offset` to calculate the address of local variable
@@ -237,3 +280,105 @@ type NopIr struct{}
 
 func (ir *NopIr) ir()            {}
 func (ir *NopIr) String() string { return "NOP" }
+
+// IsTerminator reports whether instr ends a basic block
+func IsTerminator(instr Ir) bool {
+	switch instr.(type) {
+	case *JmpIr, *BrIr, *RetIr:
+		return true
+	}
+	return false
+}
+
+// Def returns the register defined by instr, or nil if it defines none
+func Def(instr Ir) *Register {
+	switch instr := instr.(type) {
+	case *BinaryOpIr:
+		return instr.R0
+	case *UnaryOpIr:
+		return instr.R0
+	case *ImmIr:
+		return instr.R
+	case *ArgcIr:
+		return instr.R
+	case *ArgIr:
+		return instr.R0
+	case *GetsIr:
+		return instr.R
+	case *EofIr:
+		return instr.R
+	case *CallIr:
+		return instr.Return
+	case *BprelIr:
+		return instr.R
+	case *LoadIr:
+		return instr.R0
+	case *MovIr:
+		return instr.R0
+	}
+	return nil
+}
+
+// Uses returns the registers read by instr
+func Uses(instr Ir) []*Register {
+	switch instr := instr.(type) {
+	case *BinaryOpIr:
+		return []*Register{instr.R1, instr.R2}
+	case *UnaryOpIr:
+		return []*Register{instr.R1}
+	case *BrIr:
+		return []*Register{instr.R}
+	case *PutsIr:
+		return []*Register{instr.R}
+	case *ArgIr:
+		return []*Register{instr.R1}
+	case *RetIr:
+		return []*Register{instr.R}
+	case *CallIr:
+		return instr.Arguments
+	case *LoadIr:
+		return []*Register{instr.R1}
+	case *StoreIr:
+		return []*Register{instr.R0, instr.R1}
+	case *MovIr:
+		return []*Register{instr.R1}
+	}
+	return nil
+}
+
+// ReplaceUses replaces the registers read by instr with their values in m
+func ReplaceUses(instr Ir, m map[*Register]*Register) {
+	replace := func(r *Register) *Register {
+		if to, ok := m[r]; ok {
+			return to
+		}
+		return r
+	}
+
+	switch instr := instr.(type) {
+	case *BinaryOpIr:
+		instr.R1 = replace(instr.R1)
+		instr.R2 = replace(instr.R2)
+	case *UnaryOpIr:
+		instr.R1 = replace(instr.R1)
+	case *BrIr:
+		instr.R = replace(instr.R)
+	case *PutsIr:
+		instr.R = replace(instr.R)
+	case *ArgIr:
+		instr.R1 = replace(instr.R1)
+	case *RetIr:
+		instr.R = replace(instr.R)
+	case *CallIr:
+		for i, r := range instr.Arguments {
+			instr.Arguments[i] = replace(r)
+		}
+	case *LoadIr:
+		instr.R1 = replace(instr.R1)
+	case *StoreIr:
+		instr.R0 = replace(instr.R0)
+		instr.R1 = replace(instr.R1)
+	case *MovIr:
+		instr.R1 = replace(instr.R1)
+	}
+}
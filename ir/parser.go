@@ -0,0 +1,435 @@
+package ir
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/d2verb/bee/ast"
+)
+
+// operandReplacer turns the punctuation between operands into spaces
+var operandReplacer = strings.NewReplacer(",", " ", "[", " ", "]", " ", "(", " ", ")", " ")
+
+// variablePattern matches the variable operand of BPREL, e.g. `x@(rbp - 8)`
+var variablePattern = regexp.MustCompile(`^([^\s@]+)(?:@\(rbp - (\d+)\))?$`)
+
+// irParser contains the state while parsing the textual form of IR
+type irParser struct {
+	program  *Program
+	function *Function
+	current  *BasicBlock
+	line     int
+
+	blocks    map[int]*BasicBlock
+	defined   map[int]bool
+	registers map[int]*Register
+	variables map[string]*ast.Variable
+	params    map[int]*ast.Variable
+}
+
+// Parse parses IR in the form printed by Program.String.
+// Labels and register numbers are local to each function. The variables of
+// a function are collected from BPREL and STORE_ARG, and its parameters are
+// the variables stored by STORE_ARG. Succs and Preds are built from the
+// terminators. Blank lines and comments starting with `#` are ignored.
+func Parse(input string) (*Program, error) {
+	p := &irParser{program: &Program{}}
+
+	for i, line := range strings.Split(input, "\n") {
+		p.line = i + 1
+
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if err := p.parseLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.line, err)
+		}
+	}
+
+	if err := p.finishFunction(); err != nil {
+		return nil, err
+	}
+
+	return p.program, nil
+}
+
+func (p *irParser) parseLine(line string) error {
+	switch {
+	case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+		if err := p.finishFunction(); err != nil {
+			return err
+		}
+		return p.beginFunction(line[1 : len(line)-1])
+	case strings.HasPrefix(line, ".L") && strings.HasSuffix(line, ":"):
+		return p.beginBasicBlock(line[:len(line)-1])
+	}
+
+	if p.current == nil {
+		return fmt.Errorf("instruction outside of basic block: %s", line)
+	}
+
+	instr, err := p.parseInstruction(line)
+	if err != nil {
+		return err
+	}
+	p.current.Irs = append(p.current.Irs, instr)
+
+	return nil
+}
+
+func (p *irParser) beginFunction(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+
+	p.function = &Function{Node: &ast.Function{Name: name}}
+	p.current = nil
+	p.blocks = make(map[int]*BasicBlock)
+	p.defined = make(map[int]bool)
+	p.registers = make(map[int]*Register)
+	p.variables = make(map[string]*ast.Variable)
+	p.params = make(map[int]*ast.Variable)
+
+	return nil
+}
+
+func (p *irParser) beginBasicBlock(label string) error {
+	if p.function == nil {
+		return fmt.Errorf("basic block outside of function: %s", label)
+	}
+
+	bb, err := p.basicBlock(label)
+	if err != nil {
+		return err
+	}
+	if p.defined[bb.Label] {
+		return fmt.Errorf("basic block %s is defined twice", label)
+	}
+	p.defined[bb.Label] = true
+
+	p.function.BasicBlocks = append(p.function.BasicBlocks, bb)
+	p.current = bb
+
+	return nil
+}
+
+// finishFunction checks the current function and adds it to the program
+func (p *irParser) finishFunction() error {
+	if p.function == nil {
+		return nil
+	}
+
+	for label := range p.blocks {
+		if !p.defined[label] {
+			return fmt.Errorf("function '%s': basic block .L%d is not defined",
+				p.function.Node.Name, label)
+		}
+	}
+
+	for i := 0; i < len(p.params); i++ {
+		param, ok := p.params[i]
+		if !ok {
+			return fmt.Errorf("function '%s': argument %d is not stored",
+				p.function.Node.Name, i)
+		}
+		p.function.Node.Parameters = append(p.function.Node.Parameters, param)
+	}
+
+	BuildCFG(p.function)
+
+	p.program.Functions = append(p.program.Functions, p.function)
+	p.function = nil
+
+	return nil
+}
+
+func (p *irParser) parseInstruction(line string) (Ir, error) {
+	// r0 = r1 OP r2 or r0 = OP r1
+	if fields := strings.Fields(line); len(fields) > 1 && fields[1] == "=" {
+		switch len(fields) {
+		case 4:
+			return p.parseUnaryOp(fields)
+		case 5:
+			return p.parseBinaryOp(fields)
+		}
+		return nil, fmt.Errorf("invalid instruction: %s", line)
+	}
+
+	opcode, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		opcode, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	// the variable operand of BPREL contains spaces and parentheses
+	if opcode == "BPREL" {
+		return p.parseBprel(rest)
+	}
+
+	operands := strings.Fields(operandReplacer.Replace(rest))
+
+	switch opcode {
+	case "BR":
+		if err := expectOperands(opcode, operands, 3); err != nil {
+			return nil, err
+		}
+		r, err := p.register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := p.basicBlock(operands[1])
+		if err != nil {
+			return nil, err
+		}
+		alternative, err := p.basicBlock(operands[2])
+		if err != nil {
+			return nil, err
+		}
+		return &BrIr{R: r, Consequence: consequence, Alternative: alternative}, nil
+	case "IMM":
+		if err := expectOperands(opcode, operands, 2); err != nil {
+			return nil, err
+		}
+		r, err := p.register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseInt(operands[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid immediate %q", operands[1])
+		}
+		return &ImmIr{R: r, Value: value}, nil
+	case "JMP":
+		if err := expectOperands(opcode, operands, 1); err != nil {
+			return nil, err
+		}
+		target, err := p.basicBlock(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		return &JmpIr{Target: target}, nil
+	case "PUTS", "GETS", "EOF", "ARGC", "RET":
+		if err := expectOperands(opcode, operands, 1); err != nil {
+			return nil, err
+		}
+		r, err := p.register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case "PUTS":
+			return &PutsIr{R: r}, nil
+		case "GETS":
+			return &GetsIr{R: r}, nil
+		case "EOF":
+			return &EofIr{R: r}, nil
+		case "ARGC":
+			return &ArgcIr{R: r}, nil
+		}
+		return &RetIr{R: r}, nil
+	case "ARG", "LOAD", "STORE", "MOV":
+		if err := expectOperands(opcode, operands, 2); err != nil {
+			return nil, err
+		}
+		r0, err := p.register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		r1, err := p.register(operands[1])
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case "ARG":
+			return &ArgIr{R0: r0, R1: r1}, nil
+		case "LOAD":
+			return &LoadIr{R0: r0, R1: r1}, nil
+		case "STORE":
+			return &StoreIr{R0: r0, R1: r1}, nil
+		}
+		return &MovIr{R0: r0, R1: r1}, nil
+	case "CALL":
+		if len(operands) < 2 {
+			return nil, fmt.Errorf("CALL expects a register and a function")
+		}
+		r, err := p.register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		arguments := []*Register{}
+		for _, operand := range operands[2:] {
+			argument, err := p.register(operand)
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, argument)
+		}
+		return &CallIr{Function: operands[1], Return: r, Arguments: arguments}, nil
+	case "STORE_ARG":
+		if err := expectOperands(opcode, operands, 2); err != nil {
+			return nil, err
+		}
+		index, err := strconv.Atoi(operands[0])
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid argument index %q", operands[0])
+		}
+		if _, ok := p.params[index]; ok {
+			return nil, fmt.Errorf("argument %d is stored twice", index)
+		}
+		variable := p.variable(operands[1])
+		p.params[index] = variable
+		return &StoreArgIr{Index: index, Var: variable}, nil
+	case "NOP":
+		if err := expectOperands(opcode, operands, 0); err != nil {
+			return nil, err
+		}
+		return &NopIr{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown instruction: %s", line)
+}
+
+func (p *irParser) parseBinaryOp(fields []string) (Ir, error) {
+	if !isBinaryOperator(fields[3]) {
+		return nil, fmt.Errorf("unknown binary operator %q", fields[3])
+	}
+
+	r0, err := p.register(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	r1, err := p.register(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	r2, err := p.register(fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return &BinaryOpIr{Operator: fields[3], R0: r0, R1: r1, R2: r2}, nil
+}
+
+func (p *irParser) parseUnaryOp(fields []string) (Ir, error) {
+	switch fields[2] {
+	case "!", "~":
+	default:
+		return nil, fmt.Errorf("unknown unary operator %q", fields[2])
+	}
+
+	r0, err := p.register(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	r1, err := p.register(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnaryOpIr{Operator: fields[2], R0: r0, R1: r1}, nil
+}
+
+func (p *irParser) parseBprel(rest string) (Ir, error) {
+	i := strings.Index(rest, ",")
+	if i < 0 {
+		return nil, fmt.Errorf("BPREL expects a register and a variable")
+	}
+
+	r, err := p.register(strings.TrimSpace(rest[:i]))
+	if err != nil {
+		return nil, err
+	}
+
+	match := variablePattern.FindStringSubmatch(strings.TrimSpace(rest[i+1:]))
+	if match == nil {
+		return nil, fmt.Errorf("invalid variable %q", strings.TrimSpace(rest[i+1:]))
+	}
+
+	offset := 0
+	if match[2] != "" {
+		offset, err = strconv.Atoi(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q", match[2])
+		}
+	}
+
+	variable := p.variable(match[1])
+	variable.Offset = offset
+
+	return &BprelIr{R: r, Var: variable}, nil
+}
+
+// register returns the register for an operand like `r3`
+func (p *irParser) register(operand string) (*Register, error) {
+	if !strings.HasPrefix(operand, "r") {
+		return nil, fmt.Errorf("expected register, got %q", operand)
+	}
+
+	no, err := strconv.Atoi(operand[1:])
+	if err != nil || no < 0 {
+		return nil, fmt.Errorf("expected register, got %q", operand)
+	}
+
+	if r, ok := p.registers[no]; ok {
+		return r, nil
+	}
+	r := &Register{VirtualNo: no}
+	p.registers[no] = r
+
+	return r, nil
+}
+
+// basicBlock returns the basic block for an operand like `.L3`.
+// Basic blocks may be referred to before they are defined.
+func (p *irParser) basicBlock(operand string) (*BasicBlock, error) {
+	if !strings.HasPrefix(operand, ".L") {
+		return nil, fmt.Errorf("expected label, got %q", operand)
+	}
+
+	label, err := strconv.Atoi(operand[2:])
+	if err != nil || label < 0 {
+		return nil, fmt.Errorf("expected label, got %q", operand)
+	}
+
+	if bb, ok := p.blocks[label]; ok {
+		return bb, nil
+	}
+	bb := &BasicBlock{Label: label}
+	p.blocks[label] = bb
+
+	return bb, nil
+}
+
+// variable returns the variable named name, declaring it on first use
+func (p *irParser) variable(name string) *ast.Variable {
+	if variable, ok := p.variables[name]; ok {
+		return variable
+	}
+
+	variable := &ast.Variable{Name: name}
+	p.variables[name] = variable
+	p.function.Node.Variables = append(p.function.Node.Variables, variable)
+
+	return variable
+}
+
+func expectOperands(opcode string, operands []string, n int) error {
+	if len(operands) != n {
+		return fmt.Errorf("%s expects %d operands, got %d", opcode, n, len(operands))
+	}
+	return nil
+}
+
+func isBinaryOperator(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>", "==", "<", "&&", "||":
+		return true
+	}
+	return false
+}
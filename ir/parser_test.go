@@ -0,0 +1,150 @@
+package ir
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+# add two arguments
+[add]
+.L0:
+  JMP .L1
+.L1:
+  STORE_ARG 0 x
+  STORE_ARG 1 y
+  BPREL r0, x@(rbp - 8)
+  LOAD r1, [r0]
+  BPREL r2, y@(rbp - 16)
+  LOAD r3, [r2]
+  r4 = r1 + r3
+  RET r4
+
+[main]
+.L0:
+  IMM r0, 3
+  IMM r1, -4
+  CALL r2, add(r0, r1)
+  r3 = ! r2
+  BR r3, .L2, .L1   # forward reference
+.L1:
+  ARGC r4
+  r5 = r4 << r0
+  PUTS r5
+  NOP
+  JMP .L2
+.L2:
+  RET r2
+`
+	expected := `[add]
+.L0:
+  JMP .L1
+.L1:
+  STORE_ARG 0 x
+  STORE_ARG 1 y
+  BPREL r0, x@(rbp - 8)
+  LOAD r1, [r0]
+  BPREL r2, y@(rbp - 16)
+  LOAD r3, [r2]
+  r4 = r1 + r3
+  RET r4
+
+[main]
+.L0:
+  IMM r0, 3
+  IMM r1, -4
+  CALL r2, add(r0, r1)
+  r3 = ! r2
+  BR r3, .L2, .L1
+.L1:
+  ARGC r4
+  r5 = r4 << r0
+  PUTS r5
+  NOP
+  JMP .L2
+.L2:
+  RET r2
+
+`
+
+	program, err := Parse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if program.String() != expected {
+		t.Fatalf("wrong program. expected=\n%s\ngot=\n%s", expected, program.String())
+	}
+
+	add := program.Functions[0].Node
+	if len(add.Parameters) != 2 || add.Parameters[0].Name != "x" || add.Parameters[1].Name != "y" {
+		t.Errorf("wrong parameters of add: %v", add.Parameters)
+	}
+	if len(add.Variables) != 2 || add.Variables[1].Offset != 16 {
+		t.Errorf("wrong variables of add: %v", add.Variables)
+	}
+
+	main := program.Functions[1]
+	br := main.BasicBlocks[0].Irs[4].(*BrIr)
+	if br.Consequence != main.BasicBlocks[2] || br.Alternative != main.BasicBlocks[1] {
+		t.Errorf("labels are not resolved to basic blocks")
+	}
+	call := main.BasicBlocks[0].Irs[2].(*CallIr)
+	ret := main.BasicBlocks[2].Irs[0].(*RetIr)
+	if call.Return != ret.R || call.Arguments[0] != main.BasicBlocks[0].Irs[0].(*ImmIr).R {
+		t.Errorf("registers are not shared between instructions")
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []string{
+		"[main]\n.L0:\n  IMM r0, 0\n  RET r0\n\n",
+		"[f]\n.L3:\n  GETS r1\n  EOF r2\n  ARG r3, r1\n  MOV r4 r3\n  r5 = ~ r4\n  STORE [r0] r5\n\n",
+		"[f]\n.L0:\n  CALL r0, g()\n  r1 = r0 || r0\n  r2 = r1 == r0\n  RET r2\n\n[g]\n.L0:\n\n",
+	}
+
+	for i, tt := range tests {
+		program, err := Parse(tt)
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if program.String() != tt {
+			t.Errorf("[test-%d] wrong program. expected=%q, got=%q", i, tt, program.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"IMM r0, 1", "line 1: instruction outside of basic block: IMM r0, 1"},
+		{".L0:", "line 1: basic block outside of function: .L0"},
+		{"[f]\n.L0:\n.L0:", "line 3: basic block .L0 is defined twice"},
+		{"[f]\n.L0:\n  JMP .L1", "function 'f': basic block .L1 is not defined"},
+		{"[f]\n.L0:\n  STORE_ARG 1 x", "function 'f': argument 0 is not stored"},
+		{"[f]\n.L0:\n  FOO r0", "line 3: unknown instruction: FOO r0"},
+		{"[f]\n.L0:\n  IMM x, 1", "line 3: expected register, got \"x\""},
+		{"[f]\n.L0:\n  IMM r0, 1a", "line 3: invalid immediate \"1a\""},
+		{"[f]\n.L0:\n  JMP r0", "line 3: expected label, got \"r0\""},
+		{"[f]\n.L0:\n  RET", "line 3: RET expects 1 operands, got 0"},
+		{"[f]\n.L0:\n  r0 = r1 ** r2", "line 3: unknown binary operator \"**\""},
+		{"[f]\n.L0:\n  r0 = - r1", "line 3: unknown unary operator \"-\""},
+		{"[f]\n.L0:\n  BPREL r0 x", "line 3: BPREL expects a register and a variable"},
+	}
+
+	for i, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ir
+
+import (
+	"fmt"
+)
+
+// verifier contains the state while verifying a function
+type verifier struct {
+	function *Function
+	blocks   map[*BasicBlock]bool
+	errors   []string
+}
+
+// Verify checks that program is well-formed and returns the problems found.
+// In each function
+//
+//   - every basic block ends with exactly one terminator (JMP, BR or RET),
+//   - JMP and BR jump only to basic blocks of the function,
+//   - Succs and Preds agree with the terminators,
+//   - every register is defined exactly once, and
+//   - every use of a register is preceded by its definition on all paths
+//     from the entry block.
+func Verify(program *Program) []string {
+	errors := []string{}
+
+	for _, function := range program.Functions {
+		v := &verifier{
+			function: function,
+			blocks:   make(map[*BasicBlock]bool),
+		}
+		v.verify()
+		errors = append(errors, v.errors...)
+	}
+
+	return errors
+}
+
+func (v *verifier) verify() {
+	if len(v.function.BasicBlocks) == 0 {
+		v.errorf(nil, "function has no basic blocks")
+		return
+	}
+
+	labels := make(map[int]bool)
+	for _, bb := range v.function.BasicBlocks {
+		if labels[bb.Label] {
+			v.errorf(bb, "label is defined twice")
+		}
+		labels[bb.Label] = true
+		v.blocks[bb] = true
+	}
+
+	for _, bb := range v.function.BasicBlocks {
+		v.verifyTerminator(bb)
+	}
+
+	// the rest relies on a valid control flow
+	if len(v.errors) != 0 {
+		return
+	}
+
+	for _, bb := range v.function.BasicBlocks {
+		v.verifyEdges(bb)
+	}
+	v.verifyRegisters()
+}
+
+func (v *verifier) verifyTerminator(bb *BasicBlock) {
+	if len(bb.Irs) == 0 || !IsTerminator(bb.Irs[len(bb.Irs)-1]) {
+		v.errorf(bb, "basic block does not end with a terminator")
+	}
+
+	for i, instr := range bb.Irs {
+		if i < len(bb.Irs)-1 && IsTerminator(instr) {
+			v.errorf(bb, "instruction after terminator '%s'", instr.String())
+		}
+
+		switch instr := instr.(type) {
+		case *JmpIr:
+			v.verifyTarget(bb, instr.Target)
+		case *BrIr:
+			v.verifyTarget(bb, instr.Consequence)
+			v.verifyTarget(bb, instr.Alternative)
+		}
+	}
+}
+
+func (v *verifier) verifyTarget(bb *BasicBlock, target *BasicBlock) {
+	if target == nil {
+		v.errorf(bb, "jump to nil basic block")
+	} else if !v.blocks[target] {
+		v.errorf(bb, "jump to .L%d which is not in the function", target.Label)
+	}
+}
+
+func (v *verifier) verifyEdges(bb *BasicBlock) {
+	succs := Successors(bb)
+	if !sameBlocks(bb.Succs, succs) {
+		v.errorf(bb, "Succs %s do not match the terminator %s",
+			blockLabels(bb.Succs), blockLabels(succs))
+	}
+
+	for _, succ := range succs {
+		if count(succ.Preds, bb) != 1 {
+			v.errorf(succ, "Preds %s should contain .L%d exactly once",
+				blockLabels(succ.Preds), bb.Label)
+		}
+	}
+
+	for _, pred := range bb.Preds {
+		if !v.blocks[pred] || count(Successors(pred), bb) == 0 {
+			v.errorf(bb, "Preds %s contain .L%d which does not jump here",
+				blockLabels(bb.Preds), pred.Label)
+		}
+	}
+}
+
+// verifyRegisters checks the definitions and uses of registers.
+// A register is available at a point if it is defined on every path from
+// the entry block to that point.
+func (v *verifier) verifyRegisters() {
+	defined := make(map[int]*BasicBlock)
+	for _, bb := range v.function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			r := Def(instr)
+			if r == nil {
+				continue
+			}
+			if _, ok := defined[r.VirtualNo]; ok {
+				v.errorf(bb, "r%d is defined more than once", r.VirtualNo)
+			}
+			defined[r.VirtualNo] = bb
+		}
+	}
+
+	// available[bb] holds the registers available at the entry of bb.
+	// A block without an entry has not been reached yet, which stands for
+	// the set of all registers.
+	entry := v.function.BasicBlocks[0]
+	available := map[*BasicBlock]map[int]bool{entry: {}}
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, bb := range v.function.BasicBlocks {
+			in, ok := available[bb]
+			if !ok {
+				continue
+			}
+
+			out := make(map[int]bool)
+			for r := range in {
+				out[r] = true
+			}
+			for _, instr := range bb.Irs {
+				if r := Def(instr); r != nil {
+					out[r.VirtualNo] = true
+				}
+			}
+
+			for _, succ := range bb.Succs {
+				if succ == entry {
+					continue
+				}
+				next, ok := available[succ]
+				if !ok {
+					next = make(map[int]bool)
+					for r := range out {
+						next[r] = true
+					}
+					available[succ] = next
+					changed = true
+					continue
+				}
+				for r := range next {
+					if !out[r] {
+						delete(next, r)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, bb := range v.function.BasicBlocks {
+		in, reachable := available[bb]
+
+		current := make(map[int]bool)
+		for r := range in {
+			current[r] = true
+		}
+
+		for _, instr := range bb.Irs {
+			for _, r := range Uses(instr) {
+				if _, ok := defined[r.VirtualNo]; !ok {
+					v.errorf(bb, "r%d is used by '%s' but never defined", r.VirtualNo, instr.String())
+				} else if reachable && !current[r.VirtualNo] {
+					v.errorf(bb, "r%d may be used by '%s' before its definition", r.VirtualNo, instr.String())
+				}
+			}
+			if r := Def(instr); r != nil {
+				current[r.VirtualNo] = true
+			}
+		}
+	}
+}
+
+func (v *verifier) errorf(bb *BasicBlock, format string, a ...interface{}) {
+	prefix := fmt.Sprintf("function '%s'", v.function.Node.Name)
+	if bb != nil {
+		prefix += fmt.Sprintf(", .L%d", bb.Label)
+	}
+	v.errors = append(v.errors, prefix+": "+fmt.Sprintf(format, a...))
+}
+
+func sameBlocks(a []*BasicBlock, b []*BasicBlock) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, bb := range a {
+		if count(a, bb) != count(b, bb) {
+			return false
+		}
+	}
+	return true
+}
+
+func count(blocks []*BasicBlock, bb *BasicBlock) int {
+	n := 0
+	for _, block := range blocks {
+		if block == bb {
+			n++
+		}
+	}
+	return n
+}
+
+func blockLabels(blocks []*BasicBlock) string {
+	labels := "["
+	for i, bb := range blocks {
+		if i > 0 {
+			labels += " "
+		}
+		labels += fmt.Sprintf(".L%d", bb.Label)
+	}
+	return labels + "]"
+}
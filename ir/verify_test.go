@@ -0,0 +1,104 @@
+package ir
+
+import (
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{
+			"[main]\n.L0:\n  IMM r0, 0\n  BR r0, .L1, .L2\n.L1:\n  JMP .L2\n.L2:\n  RET r0\n",
+			[]string{},
+		},
+		{
+			// loops keep definitions available from the entry
+			"[main]\n.L0:\n  IMM r0, 0\n  JMP .L1\n.L1:\n  BR r0, .L1, .L2\n.L2:\n  RET r0\n",
+			[]string{},
+		},
+		{
+			"[main]\n.L0:\n  IMM r0, 0\n",
+			[]string{"function 'main', .L0: basic block does not end with a terminator"},
+		},
+		{
+			"[main]\n.L0:\n  IMM r0, 0\n  RET r0\n  PUTS r0\n  RET r0\n",
+			[]string{"function 'main', .L0: instruction after terminator 'RET r0'"},
+		},
+		{
+			"[main]\n.L0:\n  IMM r0, 0\n  IMM r0, 1\n  RET r0\n",
+			[]string{"function 'main', .L0: r0 is defined more than once"},
+		},
+		{
+			"[main]\n.L0:\n  RET r0\n",
+			[]string{"function 'main', .L0: r0 is used by 'RET r0' but never defined"},
+		},
+		{
+			"[main]\n.L0:\n  IMM r0, 0\n  BR r0, .L1, .L2\n.L1:\n  IMM r1, 1\n  JMP .L2\n.L2:\n  RET r1\n",
+			[]string{"function 'main', .L2: r1 may be used by 'RET r1' before its definition"},
+		},
+		{
+			"[main]\n.L0:\n  PUTS r0\n  IMM r0, 0\n  RET r0\n",
+			[]string{"function 'main', .L0: r0 may be used by 'PUTS r0' before its definition"},
+		},
+		{
+			// unreachable blocks are not checked for paths
+			"[main]\n.L0:\n  IMM r0, 0\n  RET r0\n.L1:\n  PUTS r1\n  JMP .L2\n.L2:\n  IMM r1, 0\n  RET r1\n",
+			[]string{},
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		errors := Verify(program)
+		if len(errors) != len(tt.errors) {
+			t.Errorf("[test-%d] wrong number of errors. expected=%q, got=%q", i, tt.errors, errors)
+			continue
+		}
+
+		for j, err := range errors {
+			if err != tt.errors[j] {
+				t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.errors[j], err)
+			}
+		}
+	}
+}
+
+func TestVerifyEdges(t *testing.T) {
+	program, err := Parse("[main]\n.L0:\n  IMM r0, 0\n  BR r0, .L1, .L2\n.L1:\n  RET r0\n.L2:\n  RET r0\n")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	blocks := program.Functions[0].BasicBlocks
+	blocks[0].Succs = blocks[0].Succs[:1]
+	blocks[1].Preds = append(blocks[1].Preds, blocks[2])
+
+	expected := []string{
+		"function 'main', .L0: Succs [.L1] do not match the terminator [.L1 .L2]",
+		"function 'main', .L1: Preds [.L0 .L2] contain .L2 which does not jump here",
+	}
+
+	errors := Verify(program)
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%q, got=%q", expected, errors)
+	}
+	for i, err := range errors {
+		if err != expected[i] {
+			t.Errorf("wrong error. expected=%q, got=%q", expected[i], err)
+		}
+	}
+
+	// a jump out of the function
+	other := &BasicBlock{Label: 9}
+	blocks[1].Irs[0] = &JmpIr{Target: other}
+	errors = Verify(program)
+	if len(errors) != 1 || errors[0] != "function 'main', .L1: jump to .L9 which is not in the function" {
+		t.Errorf("wrong errors: %q", errors)
+	}
+}
@@ -1,28 +1,70 @@
 package lexer
 
-import "github.com/d2verb/bee/token"
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/d2verb/bee/token"
+)
 
 // Lexer represents the lexer and contains the source input and internal state
 type Lexer struct {
 	input        string
-	position     int // current position
-	readPosition int // next position to read
-	ch           byte
+	position     int  // current position
+	readPosition int  // next position to read
+	ch           rune // current char, decoded from UTF-8
+	line         int  // line of current char
+	column       int  // column of current char
+
+	comments []token.Comment // comments not yet attached to a token
+	errors   []string
+	reported map[token.Position]bool // ILLEGAL tokens with an error in errors
 }
 
 // New returns a new Lexer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{
+		input:    input,
+		line:     1,
+		errors:   []string{},
+		reported: make(map[token.Position]bool),
+	}
 	l.readChar()
 	return l
 }
 
-// NextToken returns the next token read from the input stream
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// Errors returns errors of lexer
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
 
+// Reported reports whether an error has already been reported for the
+// ILLEGAL token tok, so that the parser does not report it again
+func (l *Lexer) Reported(tok token.Token) bool {
+	return tok.Type == token.ILLEGAL && l.reported[tok.Pos]
+}
+
+// NextToken returns the next token read from the input stream.
+// Comments preceding the token are attached to it.
+func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 
+	pos := l.pos()
+	comments := l.comments
+	l.comments = nil
+
+	tok := l.readToken()
+	tok.Pos = pos
+	tok.Comments = comments
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case 0:
 		tok = newToken(token.EOF, ' ')
@@ -34,30 +76,74 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else if l.peekChar() == '+' {
+			l.readChar()
+			tok = token.Token{Type: token.INCREMENT, Literal: "++"}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else if l.peekChar() == '-' {
+			l.readChar()
+			tok = token.Token{Type: token.DECREMENT, Literal: "--"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tok = newToken(token.MULTIPLY, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MULTIPLY_ASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.MULTIPLY, l.ch)
+		}
 	case '/':
-		tok = newToken(token.DIVIDE, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.DIVIDE_ASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.DIVIDE, l.ch)
+		}
+	case '%':
+		tok = newToken(token.MODULO, l.ch)
 	case '!':
 		tok = newToken(token.NOT, l.ch)
+	case '~':
+		tok = newToken(token.BITNOT, l.ch)
+	case '^':
+		tok = newToken(token.BITXOR, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.LSHIFT, Literal: "<<"}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
+	case '>':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.RSHIFT, Literal: ">>"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '&':
 		if l.peekChar() == '&' {
 			l.readChar()
 			tok = token.Token{Type: token.AND, Literal: "&&"}
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = newToken(token.BITAND, l.ch)
 		}
 	case '|':
 		if l.peekChar() == '|' {
 			l.readChar()
 			tok = token.Token{Type: token.OR, Literal: "||"}
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = newToken(token.BITOR, l.ch)
 		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
@@ -71,6 +157,20 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COMMA, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case '\'':
+		pos := l.pos()
+		tok.Literal = l.readCharLiteral()
+		if _, err := UnquoteChar(tok.Literal); err != nil {
+			// readChar has already reported invalid UTF-8 in the literal
+			if utf8.ValidString(tok.Literal) {
+				l.errors = append(l.errors, fmt.Sprintf("%s: %s", pos, err))
+			}
+			l.reported[pos] = true
+			tok.Type = token.ILLEGAL
+		} else {
+			tok.Type = token.CHAR
+		}
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
@@ -81,60 +181,230 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.INT
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			// use the raw input so that invalid UTF-8 is not garbled
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
+			// readChar has reported invalid UTF-8
+			if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+				l.reported[l.pos()] = true
+			}
 		}
 	}
 	l.readChar()
 	return tok
 }
 
+// skipWhitespace skips whitespaces and comments
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readLineComment()
+		case l.ch == '/' && l.peekChar() == '*':
+			l.readBlockComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readLineComment() {
+	pos := l.pos()
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	l.comments = append(l.comments, token.Comment{Text: l.input[position:l.position], Pos: pos})
+}
+
+// readBlockComment reads a block comment. Block comments can be nested.
+func (l *Lexer) readBlockComment() {
+	pos := l.pos()
+	position := l.position
+	depth := 0
+
+	for {
+		if l.ch == 0 {
+			l.errors = append(l.errors, fmt.Sprintf("%s: unterminated block comment", pos))
+			break
+		}
+		if l.ch == '/' && l.peekChar() == '*' {
+			l.readChar()
+			depth++
+		} else if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			depth--
+		}
+		l.readChar()
+		if depth == 0 {
+			break
+		}
+	}
+
+	l.comments = append(l.comments, token.Comment{Text: l.input[position:l.position], Pos: pos})
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.position = l.readPosition
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.readPosition++
+		return
 	}
-	l.position = l.readPosition
-	l.readPosition++
+
+	ch, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	if ch == utf8.RuneError && size == 1 {
+		msg := fmt.Sprintf("%s: invalid UTF-8 encoding", l.pos())
+		l.errors = append(l.errors, msg)
+	}
+	l.ch = ch
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) pos() token.Position {
+	return token.Position{Line: l.line, Column: l.column}
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// readNumber reads an integer literal including `0x`, `0o` and `0b` prefixes
+// and `_` separators. Malformed literals like `0b12` or `12ab` are also read
+// as a single token and rejected by the parser.
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for isDigit(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readCharLiteral reads a character literal including quotes.
+// The literal is validated by UnquoteChar.
+func (l *Lexer) readCharLiteral() string {
+	position := l.position
+
+	// skip opening `'`
+	l.readChar()
+
+	for l.ch != '\'' && l.ch != '\n' && l.ch != 0 {
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch == '\n' || l.ch == 0 {
+				break
+			}
+		}
+		l.readChar()
+	}
+
+	if l.ch == '\'' {
+		l.readChar()
+	}
+
+	return l.input[position:l.position]
+}
+
+// UnquoteChar returns the value of the character literal lit (including
+// quotes). Supported escapes are \n, \t, \r, \0, \\, \', \", \xHH and
+// \u{HHHHHH}.
+func UnquoteChar(lit string) (rune, error) {
+	if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return 0, fmt.Errorf("unterminated character literal")
+	}
+
+	body := lit[1 : len(lit)-1]
+	if body == "" {
+		return 0, fmt.Errorf("empty character literal")
+	}
+
+	var value rune
+
+	if body[0] != '\\' {
+		ch, size := utf8.DecodeRuneInString(body)
+		if ch == utf8.RuneError && size == 1 {
+			return 0, fmt.Errorf("invalid UTF-8 encoding in character literal")
+		}
+		value, body = ch, body[size:]
+	} else {
+		if len(body) < 2 {
+			return 0, fmt.Errorf("unterminated character literal")
+		}
+		switch body[1] {
+		case 'n':
+			value, body = '\n', body[2:]
+		case 't':
+			value, body = '\t', body[2:]
+		case 'r':
+			value, body = '\r', body[2:]
+		case '0':
+			value, body = 0, body[2:]
+		case '\\', '\'', '"':
+			value, body = rune(body[1]), body[2:]
+		case 'x':
+			if len(body) < 4 {
+				return 0, fmt.Errorf("invalid escape sequence %q", body)
+			}
+			n, err := strconv.ParseUint(body[2:4], 16, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid escape sequence %q", body[:4])
+			}
+			value, body = rune(n), body[4:]
+		case 'u':
+			end := -1
+			for i := 2; i < len(body); i++ {
+				if body[i] == '}' {
+					end = i
+					break
+				}
+			}
+			if len(body) < 4 || body[2] != '{' || end < 0 || end-3 > 6 {
+				return 0, fmt.Errorf("invalid escape sequence %q", body)
+			}
+			n, err := strconv.ParseUint(body[3:end], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return 0, fmt.Errorf("invalid escape sequence %q", body[:end+1])
+			}
+			value, body = rune(n), body[end+1:]
+		default:
+			return 0, fmt.Errorf("unknown escape sequence %q", body[:2])
+		}
+	}
+
+	if body != "" {
+		return 0, fmt.Errorf("character literal %s has more than one character", lit)
+	}
+
+	return value, nil
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.Type, ch byte) token.Token {
+func newToken(tokenType token.Type, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
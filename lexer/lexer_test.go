@@ -9,7 +9,10 @@ import (
 func TestNextToken(t *testing.T) {
 	input := `
 foo_bar 551 = + - * /
-! < == && || ( ) { } , ; fn if else return while puts`
+! < == && || ( ) { } , ; fn if else return while puts
+% & | ^ ~ << >> a&b >
++= -= *= /= ++ -- x+++1
+0x1F 0o17 0b1010 1_000_000 x1 a2_b3 0b102 12ab`
 	tests := []struct {
 		expectedType    token.Type
 		expectedLiteral string
@@ -38,6 +41,35 @@ foo_bar 551 = + - * /
 		{token.RETURN, "return"},
 		{token.WHILE, "while"},
 		{token.PUTS, "puts"},
+		{token.MODULO, "%"},
+		{token.BITAND, "&"},
+		{token.BITOR, "|"},
+		{token.BITXOR, "^"},
+		{token.BITNOT, "~"},
+		{token.LSHIFT, "<<"},
+		{token.RSHIFT, ">>"},
+		{token.IDENT, "a"},
+		{token.BITAND, "&"},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, ">"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.MULTIPLY_ASSIGN, "*="},
+		{token.DIVIDE_ASSIGN, "/="},
+		{token.INCREMENT, "++"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "x"},
+		{token.INCREMENT, "++"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.INT, "0x1F"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1010"},
+		{token.INT, "1_000_000"},
+		{token.IDENT, "x1"},
+		{token.IDENT, "a2_b3"},
+		{token.INT, "0b102"},
+		{token.INT, "12ab"},
 		{token.EOF, " "},
 	}
 
@@ -56,3 +88,247 @@ foo_bar 551 = + - * /
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := `// leading
+x /* inline */ / y // trailing
+/* outer /* nested */ still comment */ z
+/// doc`
+	tests := []struct {
+		expectedType     token.Type
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.IDENT, "x", []string{"// leading"}},
+		{token.DIVIDE, "/", []string{"/* inline */"}},
+		{token.IDENT, "y", []string{}},
+		{token.IDENT, "z", []string{"// trailing", "/* outer /* nested */ still comment */"}},
+		{token.EOF, " ", []string{"/// doc"}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong token type. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+				i, len(tt.expectedComments), len(tok.Comments))
+		}
+
+		for j, comment := range tok.Comments {
+			if comment.Text != tt.expectedComments[j] {
+				t.Fatalf("tests[%d] - wrong comment. expected=%q, got=%q",
+					i, tt.expectedComments[j], comment.Text)
+			}
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %q", l.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "x\n  /* a /* b */ c"
+
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	expected := "2:3: unterminated block comment"
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0] != expected {
+		t.Fatalf("wrong errors. expected=%q, got=%q", expected, errors)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	input := "fn main() {\n\tx = 1; // c\n  return x;\n}"
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"fn", token.Position{Line: 1, Column: 1}},
+		{"main", token.Position{Line: 1, Column: 4}},
+		{"(", token.Position{Line: 1, Column: 8}},
+		{")", token.Position{Line: 1, Column: 9}},
+		{"{", token.Position{Line: 1, Column: 11}},
+		{"x", token.Position{Line: 2, Column: 2}},
+		{"=", token.Position{Line: 2, Column: 4}},
+		{"1", token.Position{Line: 2, Column: 6}},
+		{";", token.Position{Line: 2, Column: 7}},
+		{"return", token.Position{Line: 3, Column: 3}},
+		{"x", token.Position{Line: 3, Column: 10}},
+		{";", token.Position{Line: 3, Column: 11}},
+		{"}", token.Position{Line: 4, Column: 1}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - wrong position. expected=%s, got=%s",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "変数 = 'a' + 'é' + '\\n' + '\\\\' + '\\'' + '\\x41' + '\\u{1F600}' + '😀'; ñ1"
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.IDENT, "変数", token.Position{Line: 1, Column: 1}},
+		{token.ASSIGN, "=", token.Position{Line: 1, Column: 4}},
+		{token.CHAR, "'a'", token.Position{Line: 1, Column: 6}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 10}},
+		{token.CHAR, "'é'", token.Position{Line: 1, Column: 12}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 16}},
+		{token.CHAR, `'\n'`, token.Position{Line: 1, Column: 18}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 23}},
+		{token.CHAR, `'\\'`, token.Position{Line: 1, Column: 25}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 30}},
+		{token.CHAR, `'\''`, token.Position{Line: 1, Column: 32}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 37}},
+		{token.CHAR, `'\x41'`, token.Position{Line: 1, Column: 39}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 46}},
+		{token.CHAR, `'\u{1F600}'`, token.Position{Line: 1, Column: 48}},
+		{token.PLUS, "+", token.Position{Line: 1, Column: 60}},
+		{token.CHAR, "'😀'", token.Position{Line: 1, Column: 62}},
+		{token.SEMICOLON, ";", token.Position{Line: 1, Column: 65}},
+		{token.IDENT, "ñ1", token.Position{Line: 1, Column: 67}},
+		{token.EOF, " ", token.Position{Line: 1, Column: 69}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong token type. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - wrong position. expected=%s, got=%s",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %q", l.Errors())
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{"x \xff y", []string{"1:3: invalid UTF-8 encoding"}},
+		{"// \xfe\n", []string{"1:4: invalid UTF-8 encoding"}},
+		{"''", []string{"1:1: empty character literal"}},
+		{"'ab'", []string{"1:1: character literal 'ab' has more than one character"}},
+		{"x = 'a", []string{"1:5: unterminated character literal"}},
+		{"'\\q'", []string{`1:1: unknown escape sequence "\\q"`}},
+		{"'\\x4'", []string{`1:1: invalid escape sequence "\\x4"`}},
+		{"'\\u{110000}'", []string{`1:1: invalid escape sequence "\\u{110000}"`}},
+		// invalid UTF-8 in a character literal is reported once
+		{"puts '\xff';", []string{"1:7: invalid UTF-8 encoding"}},
+		{"'a\xff'", []string{"1:3: invalid UTF-8 encoding"}},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("tests[%d] - wrong errors. expected=%q, got=%q", i, tt.errors, errors)
+			continue
+		}
+
+		for j := range errors {
+			if errors[j] != tt.errors[j] {
+				t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.errors[j], errors[j])
+			}
+		}
+	}
+}
+
+func TestIllegalInvalidUTF8(t *testing.T) {
+	l := New("\xff")
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "\xff" {
+		t.Fatalf("wrong token. expected=ILLEGAL %q, got=%s %q", "\xff", tok.Type, tok.Literal)
+	}
+	if !l.Reported(tok) {
+		t.Errorf("invalid UTF-8 is not marked as reported")
+	}
+
+	l = New("'\xff'")
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL || !l.Reported(tok) {
+		t.Errorf("invalid UTF-8 in a character literal is not marked as reported")
+	}
+
+	// a lone '>' is left to the parser
+	l = New(">")
+	if tok := l.NextToken(); l.Reported(tok) {
+		t.Errorf("%q is marked as reported", tok.Literal)
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	f.Add("fn main() { x = 0x1F + 'a'; puts x; } // end")
+	f.Add("/* a /* b */ c */ 変数 <<= >> '\\u{1F600}'")
+	f.Add("'\\x4' \xff /* unterminated")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+
+		var last token.Position
+		for i := 0; ; i++ {
+			// every token consumes at least one char, so EOF must come in time
+			if i > len(input)+1 {
+				t.Fatalf("lexer did not reach EOF for %q", input)
+			}
+
+			tok := l.NextToken()
+
+			if tok.Pos.Line < last.Line || tok.Pos.Line == last.Line && tok.Pos.Column < last.Column {
+				t.Fatalf("position went backwards from %s to %s for %q", last, tok.Pos, input)
+			}
+			last = tok.Pos
+
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+	})
+}
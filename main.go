@@ -1,56 +1,211 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
 	"github.com/d2verb/bee/optimizer"
+	"github.com/d2verb/bee/vm"
 
 	"github.com/d2verb/bee/generator"
 
 	"github.com/d2verb/bee/checker"
 	"github.com/d2verb/bee/lexer"
 	"github.com/d2verb/bee/parser"
+	"github.com/d2verb/bee/token"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("USAGE: bee <file>")
-	} else {
-		content, err := ioutil.ReadFile(os.Args[1])
+		usage()
+		return
+	}
+
+	switch os.Args[1] {
+	case "fmt":
+		os.Exit(formatCommand(os.Args[2:]))
+	case "dump":
+		os.Exit(dumpCommand(os.Args[2:]))
+	case "build":
+		os.Exit(buildCommand(os.Args[2:]))
+	case "exec":
+		os.Exit(execCommand(os.Args[2:]))
+	case "run":
+		flags := flag.NewFlagSet("run", flag.ExitOnError)
+		options := optimizerFlags(flags)
+		flags.Parse(os.Args[2:])
+
+		if flags.NArg() < 1 {
+			usage()
+			os.Exit(1)
+		}
+
+		irProgram := compile(flags.Arg(0), *options)
+
+		exitCode, err := vm.New(irProgram, flags.Args()[1:], os.Stdin, os.Stdout).Run()
 		if err != nil {
 			fmt.Println("Error: ", err)
 			os.Exit(1)
 		}
 
-		l := lexer.New(string(content))
-
-		p := parser.New(l)
-		program := p.ParseProgram()
+		// the exit status of the process mirrors the return value of main
+		os.Exit(int(exitCode))
+	default:
+		flags := flag.NewFlagSet("bee", flag.ExitOnError)
+		options := optimizerFlags(flags)
+		flags.Parse(os.Args[1:])
 
-		if errors := p.Errors(); len(errors) != 0 {
-			for _, err := range errors {
-				fmt.Println(err)
-			}
+		if flags.NArg() != 1 {
+			usage()
 			os.Exit(1)
 		}
 
-		c := checker.New(program)
-		c.Check()
+		irProgram := compile(flags.Arg(0), *options)
+		fmt.Print(irProgram.String())
+	}
+}
+
+func usage() {
+	fmt.Println("USAGE: bee [optimizer flags] <file>")
+	fmt.Println("       bee run [optimizer flags] <file> [arguments...]")
+	fmt.Println("       bee fmt [-w] [-d] <file>...")
+	fmt.Println("       bee dump [-ast|-ir] [-json] [optimizer flags] <file>")
+	fmt.Println("       " + buildUsage)
+	fmt.Println("       " + execUsage)
+	fmt.Println()
+	fmt.Println("optimizer flags: [-O0|-O1|-O2] [-verify-ir] [-remarks] [-print-after-all] [-print-changed]")
+}
+
+// compileOptions holds the flags which control compilation
+type compileOptions struct {
+	optimizer.Options
+	remarks bool
+}
+
+// optimizerFlags registers the flags which control the optimizer
+func optimizerFlags(flags *flag.FlagSet) *compileOptions {
+	options := &compileOptions{Options: optimizer.Options{Level: 1}}
+	for level := 0; level <= 2; level++ {
+		flags.Var(&levelFlag{&options.Options, level}, fmt.Sprintf("O%d", level),
+			fmt.Sprintf("set the optimization level to %d (default 1)", level))
+	}
+	flags.BoolVar(&options.VerifyIR, "verify-ir", false, "verify the IR after each optimizer pass")
+	flags.BoolVar(&options.remarks, "remarks", false, "report the transformations made by the optimizer to stderr")
+	flags.BoolVar(&options.PrintAfterAll, "print-after-all", false, "print the IR after each optimizer pass to stderr")
+	flags.BoolVar(&options.PrintChanged, "print-changed", false, "print the changes made by each optimizer pass to stderr as a diff")
+	return options
+}
+
+// levelFlag is a boolean flag like -O2 which sets the optimization level
+type levelFlag struct {
+	options *optimizer.Options
+	level   int
+}
+
+func (f *levelFlag) String() string {
+	return ""
+}
+
+func (f *levelFlag) Set(value string) error {
+	if value != "true" {
+		return fmt.Errorf("-O%d does not take a value", f.level)
+	}
+	f.options.Level = f.level
+	return nil
+}
+
+func (f *levelFlag) IsBoolFlag() bool {
+	return true
+}
+
+// compile reads the source file and translates it into optimized IR.
+// Files with the .ir extension are read as IR in the form printed by bee.
+// Any error terminates the process.
+func compile(filename string, options compileOptions) *ir.Program {
+	var irProgram *ir.Program
+
+	if filepath.Ext(filename) == ".ir" {
+		irProgram = parseIR(filename)
+	} else {
+		generator := generator.New(parse(filename))
+		irProgram = generator.Generate()
+	}
+
+	options.Warn = func(pos token.Position, message string) {
+		fmt.Fprintf(os.Stderr, "%s:%s: warning: %s\n", filename, pos, message)
+	}
 
-		if errors := c.Errors(); len(errors) != 0 {
-			for _, err := range errors {
-				fmt.Println(err)
+	if options.remarks {
+		options.Remark = func(remark optimizer.Remark) {
+			if remark.Pos.Line == 0 {
+				fmt.Fprintf(os.Stderr, "%s: remark: %s\n", filename, remark)
+				return
 			}
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "%s:%s: remark: %s\n", filename, remark.Pos, remark)
 		}
+	}
 
-		generator := generator.New(program)
-		irProgram := generator.Generate()
+	if err := optimizer.Optimize(irProgram, options.Options); err != nil {
+		fmt.Printf("%s: %s\n", filename, err)
+		os.Exit(1)
+	}
 
-		optimizer.LocalOptimize(irProgram)
+	return irProgram
+}
 
-		fmt.Print(irProgram.String())
+// parse reads the source file and returns the checked AST.
+// Any error terminates the process.
+func parse(filename string) *ast.Program {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+
+	l := lexer.New(string(content))
+
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) != 0 {
+		for _, err := range errors {
+			fmt.Println(err)
+		}
+		os.Exit(1)
+	}
+
+	c := checker.New(program)
+	c.Check()
+
+	if errors := c.Errors(); len(errors) != 0 {
+		for _, err := range errors {
+			fmt.Println(err)
+		}
+		os.Exit(1)
 	}
+
+	return program
+}
+
+// parseIR reads the IR file and returns the IR program.
+// Any error terminates the process.
+func parseIR(filename string) *ir.Program {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+
+	irProgram, err := ir.Parse(string(content))
+	if err != nil {
+		fmt.Printf("%s: %s\n", filename, err)
+		os.Exit(1)
+	}
+
+	return irProgram
 }
@@ -0,0 +1,234 @@
+package optimizer
+
+import (
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// EliminateDeadStores removes unreachable blocks, stores to variables which
+// are never loaded before they are overwritten or the function returns, the
+// computations which only fed them, and the variables which are no longer
+// referenced from ast.Function.Variables so that frames shrink. Parameters
+// are kept.
+func EliminateDeadStores(program *ir.Program) bool {
+	return removeDeadCode(program, nil)
+}
+
+func removeDeadCode(program *ir.Program, o *optimizer) bool {
+	changed := false
+
+	for _, function := range program.Functions {
+		if n := removeUnreachableBlocks(function); n > 0 {
+			o.remark(function, token.Position{}, "removed %s", plural(n, "unreachable block"))
+			changed = true
+		}
+		if n := eliminateDeadStores(function); n > 0 {
+			o.remark(function, token.Position{}, "removed %s", plural(n, "dead store"))
+			changed = true
+		}
+		if n := eliminateDeadCode(function); n > 0 {
+			o.remark(function, token.Position{}, "removed %s", plural(n, "unused instruction"))
+			changed = true
+		}
+		for _, variable := range removeUnusedVariables(function) {
+			o.remark(function, token.Position{}, "removed unused variable '%s'", variable.Name)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// removeUnreachableBlocks returns the number of blocks removed
+func removeUnreachableBlocks(function *ir.Function) int {
+	reachable := make(map[*ir.BasicBlock]bool)
+	for _, bb := range ir.ReversePostorder(function) {
+		reachable[bb] = true
+	}
+
+	blocks := []*ir.BasicBlock{}
+	for _, bb := range function.BasicBlocks {
+		if reachable[bb] {
+			blocks = append(blocks, bb)
+		}
+	}
+
+	removed := len(function.BasicBlocks) - len(blocks)
+	if removed == 0 {
+		return 0
+	}
+
+	function.BasicBlocks = blocks
+	ir.BuildCFG(function)
+
+	return removed
+}
+
+// variableSet is a set of variables
+type variableSet map[*ast.Variable]bool
+
+// eliminateDeadStores returns the number of stores removed
+func eliminateDeadStores(function *ir.Function) int {
+	// the variables which addresses refer to
+	addresses := make(map[*ir.Register]*ast.Variable)
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			if bprel, ok := instr.(*ir.BprelIr); ok {
+				addresses[bprel.R] = bprel.Var
+			}
+		}
+	}
+
+	// memory accessed through unknown addresses may be any variable
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			switch instr := instr.(type) {
+			case *ir.LoadIr:
+				if _, ok := addresses[instr.R1]; !ok {
+					return 0
+				}
+			case *ir.StoreIr:
+				if _, ok := addresses[instr.R0]; !ok {
+					return 0
+				}
+			}
+		}
+	}
+
+	// liveIn[bb] holds the variables which may be loaded after the entry
+	// of bb before they are stored
+	liveIn := make(map[*ir.BasicBlock]variableSet)
+
+	liveOut := func(bb *ir.BasicBlock) variableSet {
+		live := make(variableSet)
+		for _, succ := range bb.Succs {
+			for variable := range liveIn[succ] {
+				live[variable] = true
+			}
+		}
+		return live
+	}
+
+	// transfer updates live from the end of bb to its entry. Dead stores
+	// are replaced with NOP if remove is set.
+	transfer := func(bb *ir.BasicBlock, live variableSet, remove bool) int {
+		removed := 0
+		for i := len(bb.Irs) - 1; i >= 0; i-- {
+			switch instr := bb.Irs[i].(type) {
+			case *ir.LoadIr:
+				live[addresses[instr.R1]] = true
+			case *ir.StoreIr:
+				variable := addresses[instr.R0]
+				if !live[variable] && remove {
+					bb.Irs[i] = &ir.NopIr{}
+					removed++
+				}
+				delete(live, variable)
+			case *ir.StoreArgIr:
+				delete(live, instr.Var)
+			}
+		}
+		return removed
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(function.BasicBlocks) - 1; i >= 0; i-- {
+			bb := function.BasicBlocks[i]
+
+			live := liveOut(bb)
+			transfer(bb, live, false)
+
+			// the sets only grow, so comparing sizes is enough
+			if len(live) != len(liveIn[bb]) {
+				liveIn[bb] = live
+				changed = true
+			}
+		}
+	}
+
+	removed := 0
+	for _, bb := range function.BasicBlocks {
+		removed += transfer(bb, liveOut(bb), true)
+	}
+
+	if removed > 0 {
+		EliminateNop(&ir.Program{Functions: []*ir.Function{function}})
+	}
+
+	return removed
+}
+
+// eliminateDeadCode removes instructions without side effects whose results
+// are never used and returns their number. Division and modulo are kept
+// since they may fail.
+func eliminateDeadCode(function *ir.Function) int {
+	removed := 0
+
+	for changed := true; changed; {
+		changed = false
+
+		used := make(map[*ir.Register]bool)
+		for _, bb := range function.BasicBlocks {
+			for _, instr := range bb.Irs {
+				for _, r := range ir.Uses(instr) {
+					used[r] = true
+				}
+			}
+		}
+
+		for _, bb := range function.BasicBlocks {
+			irs := []ir.Ir{}
+			for _, instr := range bb.Irs {
+				if r := ir.Def(instr); r != nil && !used[r] && isRemovable(instr) {
+					removed++
+					changed = true
+					continue
+				}
+				irs = append(irs, instr)
+			}
+			bb.Irs = irs
+		}
+	}
+
+	return removed
+}
+
+func isRemovable(instr ir.Ir) bool {
+	switch instr := instr.(type) {
+	case *ir.ImmIr, *ir.BprelIr, *ir.ArgcIr, *ir.MovIr, *ir.UnaryOpIr, *ir.LoadIr:
+		return true
+	case *ir.BinaryOpIr:
+		return instr.Operator != "/" && instr.Operator != "%"
+	}
+	return false
+}
+
+// removeUnusedVariables returns the variables removed
+func removeUnusedVariables(function *ir.Function) []*ast.Variable {
+	referenced := make(variableSet)
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			switch instr := instr.(type) {
+			case *ir.BprelIr:
+				referenced[instr.Var] = true
+			case *ir.StoreArgIr:
+				referenced[instr.Var] = true
+			}
+		}
+	}
+
+	variables := []*ast.Variable{}
+	removed := []*ast.Variable{}
+	for _, variable := range function.Node.Variables {
+		if referenced[variable] || isParameter(function.Node, variable) {
+			variables = append(variables, variable)
+		} else {
+			removed = append(removed, variable)
+		}
+	}
+
+	function.Node.Variables = variables
+	return removed
+}
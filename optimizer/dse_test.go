@@ -0,0 +1,118 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+)
+
+func TestEliminateDeadStores(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		variables []string
+	}{
+		{
+			// x is never loaded
+			"[f]\n.L0:\n  IMM r0, 1\n  BPREL r1, x\n  STORE [r1] r0\n  IMM r2, 0\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r2, 0\n  RET r2\n\n",
+			[]string{},
+		},
+		{
+			// the first store is overwritten before it is loaded
+			"[f]\n.L0:\n  IMM r0, 1\n  BPREL r1, x\n  STORE [r1] r0\n  ARGC r2\n  STORE [r1] r2\n  LOAD r3, [r1]\n  RET r3\n",
+			"[f]\n.L0:\n  BPREL r1, x@(rbp - 0)\n  ARGC r2\n  STORE [r1] r2\n  LOAD r3, [r1]\n  RET r3\n\n",
+			[]string{"x"},
+		},
+		{
+			// loaded in a successor, but dead on return
+			"[f]\n.L0:\n  STORE_ARG 0 p\n  IMM r0, 1\n  BPREL r1, x\n  STORE [r1] r0\n  BR r0, .L1, .L2\n" +
+				".L1:\n  LOAD r2, [r1]\n  PUTS r2\n  STORE [r1] r0\n  JMP .L2\n.L2:\n  RET r0\n",
+			"[f]\n.L0:\n  STORE_ARG 0 p\n  IMM r0, 1\n  BPREL r1, x@(rbp - 0)\n  STORE [r1] r0\n  BR r0, .L1, .L2\n" +
+				".L1:\n  LOAD r2, [r1]\n  PUTS r2\n  JMP .L2\n.L2:\n  RET r0\n\n",
+			[]string{"p", "x"},
+		},
+		{
+			// the store in the loop is loaded in the next iteration
+			"[f]\n.L0:\n  BPREL r0, i\n  GETS r1\n  STORE [r0] r1\n  JMP .L1\n" +
+				".L1:\n  LOAD r2, [r0]\n  BR r2, .L2, .L3\n" +
+				".L2:\n  IMM r3, 1\n  r4 = r2 - r3\n  STORE [r0] r4\n  JMP .L1\n.L3:\n  RET r2\n",
+			"[f]\n.L0:\n  BPREL r0, i@(rbp - 0)\n  GETS r1\n  STORE [r0] r1\n  JMP .L1\n" +
+				".L1:\n  LOAD r2, [r0]\n  BR r2, .L2, .L3\n" +
+				".L2:\n  IMM r3, 1\n  r4 = r2 - r3\n  STORE [r0] r4\n  JMP .L1\n.L3:\n  RET r2\n\n",
+			[]string{"i"},
+		},
+		{
+			// unreachable blocks and unused loads are removed
+			"[f]\n.L0:\n  BPREL r0, x\n  LOAD r1, [r0]\n  GETS r2\n  RET r2\n.L1:\n  PUTS r1\n  JMP .L0\n",
+			"[f]\n.L0:\n  GETS r2\n  RET r2\n\n",
+			[]string{},
+		},
+		{
+			// stores through unknown addresses are kept
+			"[f]\n.L0:\n  IMM r0, 0\n  BPREL r1, x\n  STORE [r1] r0\n  STORE [r0] r0\n  RET r0\n",
+			"[f]\n.L0:\n  IMM r0, 0\n  BPREL r1, x@(rbp - 0)\n  STORE [r1] r0\n  STORE [r0] r0\n  RET r0\n\n",
+			[]string{"x"},
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		EliminateDeadStores(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("[test-%d] wrong program. expected=\n%s\ngot=\n%s", i, tt.expected, program.String())
+		}
+
+		variables := []string{}
+		for _, variable := range program.Functions[0].Node.Variables {
+			variables = append(variables, variable.Name)
+		}
+		if len(variables) != len(tt.variables) {
+			t.Errorf("[test-%d] wrong variables. expected=%q, got=%q", i, tt.variables, variables)
+			continue
+		}
+		for j := range variables {
+			if variables[j] != tt.variables[j] {
+				t.Errorf("[test-%d] wrong variables. expected=%q, got=%q", i, tt.variables, variables)
+			}
+		}
+	}
+}
+
+func TestEliminateDeadStoresRun(t *testing.T) {
+	tests := []string{
+		"fn main() { x = 1; x = 2; y = x + 1; unused = y * 2; return y; }",
+		"fn main() { i = 0; s = 0; while (i < 5) { t = i * i; s += t; i++; } return s; }",
+		"fn main() { x = 5; if (argc() == 0) { x = 7; } puts x; }",
+		"fn main() { return f(2); } fn f(n) { a = n; b = a + 1; a = b * 2; return a; }",
+	}
+
+	for i, tt := range tests {
+		expected, expectedCode := run(t, compile(t, tt))
+
+		program := compile(t, tt)
+		NumberValues(program)
+		EliminateDeadStores(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		actual, actualCode := run(t, program)
+		if actual != expected || actualCode != expectedCode {
+			t.Errorf("[test-%d] wrong result. expected=(%q, %d), got=(%q, %d)",
+				i, expected, expectedCode, actual, actualCode)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package optimizer
+
+import (
+	"fmt"
+
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// valueNumbering contains the state while numbering values of a function
+type valueNumbering struct {
+	dominators *ir.Dominators
+	available  map[string]*ir.Register // registers holding each expression
+	replaced   map[*ir.Register]*ir.Register
+	removed    int
+	changed    bool
+}
+
+// NumberValues removes pure instructions which compute a value already held
+// by a register defined in a dominating position, and rewrites the uses of
+// their results. Expressions are available in the blocks dominated by the
+// block computing them, so that both repeated computations in a block and
+// across blocks are found.
+func NumberValues(program *ir.Program) bool {
+	return numberValues(program, nil)
+}
+
+func numberValues(program *ir.Program, o *optimizer) bool {
+	changed := false
+
+	for _, function := range program.Functions {
+		vn := &valueNumbering{
+			dominators: ir.ComputeDominators(function),
+			available:  make(map[string]*ir.Register),
+			replaced:   make(map[*ir.Register]*ir.Register),
+		}
+
+		vn.visit(function.BasicBlocks[0])
+
+		// unreachable blocks may still use the removed registers
+		for _, bb := range function.BasicBlocks {
+			for _, instr := range bb.Irs {
+				ir.ReplaceUses(instr, vn.replaced)
+			}
+		}
+
+		if vn.removed > 0 {
+			o.remark(function, token.Position{}, "removed %s", plural(vn.removed, "redundant computation"))
+		}
+
+		if vn.changed {
+			EliminateNop(&ir.Program{Functions: []*ir.Function{function}})
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// visit numbers the values of bb and the blocks it dominates
+func (vn *valueNumbering) visit(bb *ir.BasicBlock) {
+	added := []string{}
+
+	for i, instr := range bb.Irs {
+		ir.ReplaceUses(instr, vn.replaced)
+
+		// a copy has the value of its source
+		if mov, ok := instr.(*ir.MovIr); ok {
+			vn.replaced[mov.R0] = mov.R1
+			bb.Irs[i] = &ir.NopIr{}
+			vn.changed = true
+			continue
+		}
+
+		key, ok := expression(instr)
+		if !ok {
+			continue
+		}
+
+		if r, ok := vn.available[key]; ok {
+			vn.replaced[ir.Def(instr)] = r
+			bb.Irs[i] = &ir.NopIr{}
+			vn.removed++
+			vn.changed = true
+			continue
+		}
+
+		vn.available[key] = ir.Def(instr)
+		added = append(added, key)
+	}
+
+	for _, child := range vn.dominators.Children(bb) {
+		vn.visit(child)
+	}
+
+	// the expressions of bb are not available in its siblings
+	for _, key := range added {
+		delete(vn.available, key)
+	}
+}
+
+// expression returns a key which is equal for instructions computing the
+// same value, or false if instr is not pure
+func expression(instr ir.Ir) (string, bool) {
+	switch instr := instr.(type) {
+	case *ir.ImmIr:
+		return fmt.Sprintf("IMM %d", instr.Value), true
+	case *ir.BprelIr:
+		return fmt.Sprintf("BPREL %p", instr.Var), true
+	case *ir.ArgcIr:
+		return "ARGC", true
+	case *ir.UnaryOpIr:
+		return fmt.Sprintf("%s r%d", instr.Operator, instr.R1.VirtualNo), true
+	case *ir.BinaryOpIr:
+		r1, r2 := instr.R1.VirtualNo, instr.R2.VirtualNo
+		if isCommutative(instr.Operator) && r1 > r2 {
+			r1, r2 = r2, r1
+		}
+		return fmt.Sprintf("r%d %s r%d", r1, instr.Operator, r2), true
+	}
+	return "", false
+}
+
+func isCommutative(op string) bool {
+	switch op {
+	case "+", "*", "&", "|", "^", "==", "&&", "||":
+		return true
+	}
+	return false
+}
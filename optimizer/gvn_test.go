@@ -0,0 +1,86 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+)
+
+func TestNumberValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"[f]\n.L0:\n  BPREL r0, x\n  LOAD r1, [r0]\n  BPREL r2, x\n  LOAD r3, [r2]\n" +
+				"  r4 = r1 + r3\n  r5 = r3 + r1\n  r6 = r4 * r5\n  RET r6\n",
+			"[f]\n.L0:\n  BPREL r0, x@(rbp - 0)\n  LOAD r1, [r0]\n  LOAD r3, [r0]\n" +
+				"  r4 = r1 + r3\n  r6 = r4 * r4\n  RET r6\n\n",
+		},
+		{
+			// non-commutative operators keep the order of operands
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 1\n  r2 = r0 - r1\n  r3 = r1 - r0\n  r4 = r2 < r3\n  RET r4\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 1\n  r2 = r0 - r1\n  r3 = r1 - r0\n  r4 = r2 < r3\n  RET r4\n\n",
+		},
+		{
+			// values of a dominator are reused, but not those of a sibling
+			"[f]\n.L0:\n  IMM r0, 1\n  BR r0, .L1, .L2\n" +
+				".L1:\n  IMM r1, 1\n  IMM r2, 2\n  PUTS r2\n  JMP .L3\n" +
+				".L2:\n  IMM r3, 2\n  r4 = r3 + r0\n  PUTS r4\n  JMP .L3\n" +
+				".L3:\n  IMM r5, 1\n  RET r5\n",
+			"[f]\n.L0:\n  IMM r0, 1\n  BR r0, .L1, .L2\n" +
+				".L1:\n  IMM r2, 2\n  PUTS r2\n  JMP .L3\n" +
+				".L2:\n  IMM r3, 2\n  r4 = r3 + r0\n  PUTS r4\n  JMP .L3\n" +
+				".L3:\n  RET r0\n\n",
+		},
+		{
+			// copies are propagated
+			"[f]\n.L0:\n  GETS r0\n  MOV r1 r0\n  r2 = ! r1\n  r3 = ! r0\n  r4 = r2 + r3\n  RET r4\n",
+			"[f]\n.L0:\n  GETS r0\n  r2 = ! r0\n  r4 = r2 + r2\n  RET r4\n\n",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		NumberValues(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("[test-%d] wrong program. expected=\n%s\ngot=\n%s", i, tt.expected, program.String())
+		}
+	}
+}
+
+func TestNumberValuesRun(t *testing.T) {
+	tests := []string{
+		"fn main() { x = 3; y = x * x + x * x; puts y; if (x < y) { puts x * x; } else { puts 0; } return x * x; }",
+		"fn main() { i = 0; while (i < 3) { puts i + i; i = i + 1; puts i + i; } }",
+		"fn main() { x = argc(); y = argc(); puts x == y; x += 1; puts x == y; }",
+	}
+
+	for i, tt := range tests {
+		expected, expectedCode := run(t, compile(t, tt))
+
+		program := compile(t, tt)
+		NumberValues(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		actual, actualCode := run(t, program)
+		if actual != expected || actualCode != expectedCode {
+			t.Errorf("[test-%d] wrong result. expected=(%q, %d), got=(%q, %d)",
+				i, expected, expectedCode, actual, actualCode)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package optimizer
+
+import (
+	"fmt"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+)
+
+const (
+	// inlineThreshold is the maximum number of instructions of a callee
+	inlineThreshold = 40
+
+	// maxFunctionSize stops inlining into a function which has grown larger
+	maxFunctionSize = 2000
+)
+
+// inliner contains the state while inlining calls
+type inliner struct {
+	*allocator
+	*optimizer
+	functions map[string]*ir.Function
+	recursive map[string]bool
+	sites     int
+}
+
+// Inline replaces calls of small functions with their bodies.
+// Recursive functions, including mutually recursive ones, are never inlined.
+func Inline(program *ir.Program) bool {
+	return inlineCalls(program, nil)
+}
+
+func inlineCalls(program *ir.Program, o *optimizer) bool {
+	in := &inliner{
+		allocator: newAllocator(program),
+		optimizer: o,
+		functions: make(map[string]*ir.Function),
+		recursive: recursiveFunctions(program),
+	}
+
+	for _, function := range program.Functions {
+		in.functions[function.Node.Name] = function
+	}
+
+	changed := false
+
+	for _, caller := range program.Functions {
+		inlined := false
+
+		for i := 0; i < len(caller.BasicBlocks); i++ {
+			bb := caller.BasicBlocks[i]
+			for j, instr := range bb.Irs {
+				call, ok := instr.(*ir.CallIr)
+				if !ok || !in.shouldInline(caller, call) {
+					continue
+				}
+				in.remark(caller, call.Pos, "inlined call to '%s'", call.Function)
+				in.inline(caller, i, j)
+				inlined = true
+				// the rest of bb has been moved to the continuation block
+				break
+			}
+		}
+
+		if inlined {
+			ir.BuildCFG(caller)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (in *inliner) shouldInline(caller *ir.Function, call *ir.CallIr) bool {
+	callee, ok := in.functions[call.Function]
+	if !ok || callee == caller || in.recursive[call.Function] {
+		return false
+	}
+	if len(call.Arguments) != len(callee.Node.Parameters) || countReturns(callee) == 0 {
+		return false
+	}
+	return size(callee) <= inlineThreshold && size(caller) <= maxFunctionSize
+}
+
+// inline replaces the call at caller.BasicBlocks[i].Irs[j] with a copy of
+// the callee.
+//
+//	.L1:              .L1:
+//	  ...               ...
+//	  CALL r0, f()      JMP .L10
+//	  PUTS r0         .L10:          # copy of f, RET is replaced with
+//	  ...               ...          # JMP .L11
+//	                  .L11:
+//	                    PUTS r0
+//	                    ...
+func (in *inliner) inline(caller *ir.Function, i int, j int) {
+	bb := caller.BasicBlocks[i]
+	call := bb.Irs[j].(*ir.CallIr)
+	callee := in.functions[call.Function]
+
+	in.sites++
+
+	c := &cloner{
+		inliner:   in,
+		call:      call,
+		registers: make(map[*ir.Register]*ir.Register),
+		blocks:    make(map[*ir.BasicBlock]*ir.BasicBlock),
+		variables: make(map[*ast.Variable]*ast.Variable),
+		returns:   countReturns(callee),
+	}
+
+	// fresh copies of the local variables of the callee
+	for _, variable := range callee.Node.Variables {
+		clone := &ast.Variable{
+			Name: fmt.Sprintf("%s.%s.%d", callee.Node.Name, variable.Name, in.sites),
+		}
+		c.variables[variable] = clone
+		caller.Node.Variables = append(caller.Node.Variables, clone)
+	}
+	if c.returns > 1 {
+		c.result = &ast.Variable{Name: fmt.Sprintf("%s.ret.%d", callee.Node.Name, in.sites)}
+		caller.Node.Variables = append(caller.Node.Variables, c.result)
+	}
+
+	for _, calleeBB := range callee.BasicBlocks {
+		c.blocks[calleeBB] = in.newBasicBlock()
+	}
+	c.continuation = in.newBasicBlock()
+
+	// the body is executed in a new activation, so the variables which are
+	// not parameters start from zero on every call
+	entry := c.blocks[callee.BasicBlocks[0]]
+	locals := []*ast.Variable{}
+	for _, variable := range callee.Node.Variables {
+		if !isParameter(callee.Node, variable) {
+			locals = append(locals, c.variables[variable])
+		}
+	}
+	entry.Irs = append(entry.Irs, in.clearVariables(locals)...)
+
+	clones := []*ir.BasicBlock{}
+	for _, calleeBB := range callee.BasicBlocks {
+		clone := c.blocks[calleeBB]
+		for _, instr := range calleeBB.Irs {
+			clone.Irs = append(clone.Irs, c.clone(instr)...)
+		}
+		clones = append(clones, clone)
+	}
+
+	if c.returns > 1 {
+		address := in.newRegister()
+		c.continuation.Irs = append(c.continuation.Irs,
+			&ir.BprelIr{R: address, Var: c.result},
+			&ir.LoadIr{R0: call.Return, R1: address})
+	}
+	c.continuation.Irs = append(c.continuation.Irs, bb.Irs[j+1:]...)
+
+	bb.Irs = append(bb.Irs[:j:j], &ir.JmpIr{Target: entry})
+
+	blocks := append([]*ir.BasicBlock{}, caller.BasicBlocks[:i+1]...)
+	blocks = append(blocks, clones...)
+	blocks = append(blocks, c.continuation)
+	caller.BasicBlocks = append(blocks, caller.BasicBlocks[i+1:]...)
+}
+
+// cloner copies the instructions of a callee for a single call site
+type cloner struct {
+	*inliner
+	call         *ir.CallIr
+	registers    map[*ir.Register]*ir.Register
+	blocks       map[*ir.BasicBlock]*ir.BasicBlock
+	variables    map[*ast.Variable]*ast.Variable
+	returns      int
+	result       *ast.Variable // holds the return value if there are several RETs
+	continuation *ir.BasicBlock
+}
+
+func (c *cloner) register(r *ir.Register) *ir.Register {
+	if clone, ok := c.registers[r]; ok {
+		return clone
+	}
+	clone := c.newRegister()
+	c.registers[r] = clone
+	return clone
+}
+
+func (c *cloner) clone(instr ir.Ir) []ir.Ir {
+	switch instr := instr.(type) {
+	case *ir.BinaryOpIr:
+		return []ir.Ir{&ir.BinaryOpIr{
+			Operator: instr.Operator,
+			R0:       c.register(instr.R0),
+			R1:       c.register(instr.R1),
+			R2:       c.register(instr.R2),
+			Pos:      instr.Pos,
+		}}
+	case *ir.UnaryOpIr:
+		return []ir.Ir{&ir.UnaryOpIr{
+			Operator: instr.Operator,
+			R0:       c.register(instr.R0),
+			R1:       c.register(instr.R1),
+		}}
+	case *ir.BrIr:
+		return []ir.Ir{&ir.BrIr{
+			R:           c.register(instr.R),
+			Consequence: c.blocks[instr.Consequence],
+			Alternative: c.blocks[instr.Alternative],
+		}}
+	case *ir.ImmIr:
+		return []ir.Ir{&ir.ImmIr{R: c.register(instr.R), Value: instr.Value}}
+	case *ir.JmpIr:
+		return []ir.Ir{&ir.JmpIr{Target: c.blocks[instr.Target]}}
+	case *ir.PutsIr:
+		return []ir.Ir{&ir.PutsIr{R: c.register(instr.R)}}
+	case *ir.ArgcIr:
+		return []ir.Ir{&ir.ArgcIr{R: c.register(instr.R)}}
+	case *ir.ArgIr:
+		return []ir.Ir{&ir.ArgIr{R0: c.register(instr.R0), R1: c.register(instr.R1)}}
+	case *ir.GetsIr:
+		return []ir.Ir{&ir.GetsIr{R: c.register(instr.R)}}
+	case *ir.EofIr:
+		return []ir.Ir{&ir.EofIr{R: c.register(instr.R)}}
+	case *ir.CallIr:
+		arguments := []*ir.Register{}
+		for _, r := range instr.Arguments {
+			arguments = append(arguments, c.register(r))
+		}
+		return []ir.Ir{&ir.CallIr{
+			Function:  instr.Function,
+			Return:    c.register(instr.Return),
+			Arguments: arguments,
+			Pos:       instr.Pos,
+		}}
+	case *ir.BprelIr:
+		return []ir.Ir{&ir.BprelIr{R: c.register(instr.R), Var: c.variables[instr.Var]}}
+	case *ir.LoadIr:
+		return []ir.Ir{&ir.LoadIr{R0: c.register(instr.R0), R1: c.register(instr.R1)}}
+	case *ir.StoreIr:
+		return []ir.Ir{&ir.StoreIr{R0: c.register(instr.R0), R1: c.register(instr.R1)}}
+	case *ir.MovIr:
+		return []ir.Ir{&ir.MovIr{R0: c.register(instr.R0), R1: c.register(instr.R1)}}
+	case *ir.StoreArgIr:
+		// arguments are passed in the registers of the call
+		return c.store(c.variables[instr.Var], c.call.Arguments[instr.Index])
+	case *ir.RetIr:
+		if c.returns > 1 {
+			return append(c.store(c.result, c.register(instr.R)),
+				&ir.JmpIr{Target: c.continuation})
+		}
+		return []ir.Ir{
+			&ir.MovIr{R0: c.call.Return, R1: c.register(instr.R)},
+			&ir.JmpIr{Target: c.continuation},
+		}
+	}
+	return nil
+}
+
+// recursiveFunctions returns the functions which may call themselves
+// directly or through other functions
+func recursiveFunctions(program *ir.Program) map[string]bool {
+	callees := make(map[string][]string)
+	for _, function := range program.Functions {
+		for _, bb := range function.BasicBlocks {
+			for _, instr := range bb.Irs {
+				if call, ok := instr.(*ir.CallIr); ok {
+					callees[function.Node.Name] = append(callees[function.Node.Name], call.Function)
+				}
+			}
+		}
+	}
+
+	recursive := make(map[string]bool)
+	for _, function := range program.Functions {
+		name := function.Node.Name
+
+		// depth-first search for a path back to name
+		visited := make(map[string]bool)
+		stack := append([]string{}, callees[name]...)
+		for len(stack) > 0 {
+			next := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if next == name {
+				recursive[name] = true
+				break
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			stack = append(stack, callees[next]...)
+		}
+	}
+
+	return recursive
+}
+
+// size returns the number of instructions of function
+func size(function *ir.Function) int {
+	n := 0
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			if _, ok := instr.(*ir.NopIr); !ok {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func countReturns(function *ir.Function) int {
+	n := 0
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			if _, ok := instr.(*ir.RetIr); ok {
+				n++
+			}
+		}
+	}
+	return n
+}
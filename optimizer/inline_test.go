@@ -0,0 +1,85 @@
+package optimizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+)
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		input string
+		calls []string // functions still called after inlining
+	}{
+		{
+			"[main]\n.L0:\n  IMM r0, 3\n  CALL r1, sq(r0)\n  RET r1\n" +
+				"[sq]\n.L1:\n  STORE_ARG 0 x\n  BPREL r2, x\n  LOAD r3, [r2]\n  r4 = r3 * r3\n  RET r4\n",
+			[]string{},
+		},
+		{
+			// recursive functions are kept
+			"[main]\n.L0:\n  IMM r0, 3\n  CALL r1, f(r0)\n  RET r1\n" +
+				"[f]\n.L1:\n  STORE_ARG 0 x\n  BPREL r2, x\n  LOAD r3, [r2]\n  CALL r4, f(r3)\n  RET r4\n",
+			[]string{"f", "f"},
+		},
+		{
+			// mutually recursive functions are kept
+			"[main]\n.L0:\n  CALL r0, f()\n  RET r0\n" +
+				"[f]\n.L1:\n  CALL r1, g()\n  RET r1\n" +
+				"[g]\n.L2:\n  CALL r2, f()\n  RET r2\n",
+			[]string{"f", "g", "f"},
+		},
+		{
+			// callees are inlined transitively
+			"[main]\n.L0:\n  CALL r0, f()\n  CALL r1, f()\n  r2 = r0 + r1\n  RET r2\n" +
+				"[f]\n.L1:\n  CALL r3, g()\n  RET r3\n" +
+				"[g]\n.L2:\n  ARGC r4\n  RET r4\n",
+			[]string{},
+		},
+		{
+			"[main]\n.L0:\n  CALL r0, big()\n  RET r0\n" +
+				"[big]\n.L1:\n" + largeBody(inlineThreshold) + "  RET r0\n",
+			[]string{"big"},
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		Inline(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		calls := []string{}
+		for _, function := range program.Functions {
+			for _, bb := range function.BasicBlocks {
+				for _, instr := range bb.Irs {
+					if call, ok := instr.(*ir.CallIr); ok {
+						calls = append(calls, call.Function)
+					}
+				}
+			}
+		}
+
+		if strings.Join(calls, " ") != strings.Join(tt.calls, " ") {
+			t.Errorf("[test-%d] wrong calls. expected=%q, got=%q", i, tt.calls, calls)
+		}
+	}
+}
+
+// largeBody returns a function body with n instructions besides RET
+func largeBody(n int) string {
+	var body strings.Builder
+	body.WriteString("  IMM r0, 0\n")
+	for i := 1; i < n; i++ {
+		body.WriteString("  PUTS r0\n")
+	}
+	return body.String()
+}
@@ -0,0 +1,163 @@
+package optimizer
+
+import (
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// HoistLoopInvariants moves pure instructions whose operands do not change
+// in a loop to the preheader of the loop, which is created if needed.
+// Division and modulo are not moved since they may fail in a loop which is
+// never entered.
+func HoistLoopInvariants(program *ir.Program) bool {
+	return hoistLoopInvariants(program, nil)
+}
+
+func hoistLoopInvariants(program *ir.Program, o *optimizer) bool {
+	a := newAllocator(program)
+
+	changed := false
+
+	for _, function := range program.Functions {
+		done := make(map[*ir.BasicBlock]bool)
+
+		// loops are found again after each change of the CFG, but every
+		// header is processed once, from inner to outer loops
+		for {
+			var loop *ir.Loop
+			for _, l := range ir.FindLoops(function, ir.ComputeDominators(function)) {
+				if !done[l.Header] {
+					loop = l
+					break
+				}
+			}
+			if loop == nil {
+				break
+			}
+			done[loop.Header] = true
+
+			if n := hoist(a, function, loop); n > 0 {
+				o.remark(function, token.Position{}, "hoisted %s out of the loop at .L%d", plural(n, "instruction"), loop.Header.Label)
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// hoist returns the number of instructions moved out of loop
+func hoist(a *allocator, function *ir.Function, loop *ir.Loop) int {
+	// registers defined in the loop
+	defined := make(map[*ir.Register]bool)
+	for _, bb := range function.BasicBlocks {
+		if !loop.Blocks[bb] {
+			continue
+		}
+		for _, instr := range bb.Irs {
+			if r := ir.Def(instr); r != nil {
+				defined[r] = true
+			}
+		}
+	}
+
+	invariants := []ir.Ir{}
+
+	// hoisting an instruction may make its users invariant
+	for found := true; found; {
+		found = false
+		for _, bb := range function.BasicBlocks {
+			if !loop.Blocks[bb] {
+				continue
+			}
+
+			irs := []ir.Ir{}
+			for _, instr := range bb.Irs {
+				if isInvariant(instr, defined) {
+					invariants = append(invariants, instr)
+					delete(defined, ir.Def(instr))
+					found = true
+					continue
+				}
+				irs = append(irs, instr)
+			}
+			bb.Irs = irs
+		}
+	}
+
+	if len(invariants) == 0 {
+		return 0
+	}
+
+	preheader := preheader(a, function, loop)
+	terminator := preheader.Irs[len(preheader.Irs)-1]
+	preheader.Irs = append(append(preheader.Irs[:len(preheader.Irs)-1], invariants...), terminator)
+
+	return len(invariants)
+}
+
+func isInvariant(instr ir.Ir, defined map[*ir.Register]bool) bool {
+	switch instr := instr.(type) {
+	case *ir.ImmIr, *ir.BprelIr, *ir.ArgcIr, *ir.MovIr, *ir.UnaryOpIr:
+	case *ir.BinaryOpIr:
+		if instr.Operator == "/" || instr.Operator == "%" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for _, r := range ir.Uses(instr) {
+		if defined[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// preheader returns the only block entering loop from outside, creating
+// one if the header has several such predecessors or one which also
+// branches elsewhere
+func preheader(a *allocator, function *ir.Function, loop *ir.Loop) *ir.BasicBlock {
+	outside := []*ir.BasicBlock{}
+	for _, pred := range loop.Header.Preds {
+		if !loop.Blocks[pred] {
+			outside = append(outside, pred)
+		}
+	}
+
+	if len(outside) == 1 && len(outside[0].Succs) == 1 {
+		return outside[0]
+	}
+
+	preheader := a.newBasicBlock()
+	preheader.Irs = append(preheader.Irs, &ir.JmpIr{Target: loop.Header})
+
+	for _, pred := range outside {
+		switch terminator := pred.Irs[len(pred.Irs)-1].(type) {
+		case *ir.JmpIr:
+			terminator.Target = preheader
+		case *ir.BrIr:
+			if terminator.Consequence == loop.Header {
+				terminator.Consequence = preheader
+			}
+			if terminator.Alternative == loop.Header {
+				terminator.Alternative = preheader
+			}
+		}
+	}
+
+	// the preheader is placed right before the header
+	blocks := []*ir.BasicBlock{}
+	for _, bb := range function.BasicBlocks {
+		if bb == loop.Header {
+			blocks = append(blocks, preheader)
+		}
+		blocks = append(blocks, bb)
+	}
+	function.BasicBlocks = blocks
+
+	ir.BuildCFG(function)
+
+	return preheader
+}
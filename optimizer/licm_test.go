@@ -0,0 +1,88 @@
+package optimizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/checker"
+	"github.com/d2verb/bee/generator"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/lexer"
+	"github.com/d2verb/bee/parser"
+	"github.com/d2verb/bee/vm"
+)
+
+func TestHoistLoopInvariants(t *testing.T) {
+	tests := []string{
+		"fn main() { i = 0; while (i < 3) { puts i * 10; i++; } }",
+		"fn main() { n = 3; i = 0; while (i < n) { j = 0; while (j < 2) { puts i * 10 + j; j++; } i++; } }",
+		// the division must not be hoisted out of a loop which is never entered
+		"fn main() { x = 0; while (x) { puts 1 / x; } return 7; }",
+		"fn main() { i = 5; while (i) { i--; if (i == 2) { puts argc() + 4; } } }",
+		"fn main() { return f(4); } fn f(n) { if (n < 1) { return 0; } s = 0; while (n) { s += n * 2; n--; } return s; }",
+		"fn main() { return f(3, 0); } fn f(n, acc) { if (n == 0) { return acc; } return f(n - 1, acc + 100 * 2); }",
+	}
+
+	for i, tt := range tests {
+		expected, expectedCode := run(t, compile(t, tt))
+
+		program := compile(t, tt)
+		LocalOptimize(program)
+		EliminateTailCalls(program)
+		HoistLoopInvariants(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		actual, actualCode := run(t, program)
+		if actual != expected || actualCode != expectedCode {
+			t.Errorf("[test-%d] wrong result. expected=(%q, %d), got=(%q, %d)",
+				i, expected, expectedCode, actual, actualCode)
+		}
+
+		// no constants are left in loops
+		for _, function := range program.Functions {
+			for _, loop := range ir.FindLoops(function, ir.ComputeDominators(function)) {
+				for bb := range loop.Blocks {
+					for _, instr := range bb.Irs {
+						switch instr.(type) {
+						case *ir.ImmIr, *ir.BprelIr:
+							t.Errorf("[test-%d] '%s' is left in loop .L%d", i, instr.String(), loop.Header.Label)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func compile(t *testing.T, input string) *ir.Program {
+	p := parser.New(lexer.New(input))
+
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %v", errors)
+	}
+
+	c := checker.New(program)
+	c.Check()
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("checker errors: %v", errors)
+	}
+
+	return generator.New(program).Generate()
+}
+
+func run(t *testing.T, program *ir.Program) (string, int64) {
+	var out bytes.Buffer
+
+	exitCode, err := vm.New(program, []string{}, strings.NewReader(""), &out).Run()
+	if err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+
+	return out.String(), exitCode
+}
@@ -1,52 +1,319 @@
 package optimizer
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/diff"
 	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// Options controls the optimizer
+type Options struct {
+	// Level is the optimization level. 0 disables all passes, 1 runs the
+	// local passes and eliminates self tail calls, and 2 also inlines small
+	// functions, removes redundant computations and dead stores and hoists
+	// loop invariants.
+	Level int
+
+	// VerifyIR runs ir.Verify on the input and after every pass
+	VerifyIR bool
+
+	// Warn receives compile-time warnings such as division by zero.
+	// Warnings are discarded if it is nil.
+	Warn func(pos token.Position, message string)
+
+	// Remark receives a description of every transformation made by the
+	// passes. Remarks are discarded if it is nil.
+	Remark func(remark Remark)
+
+	// PrintAfterAll prints the program after every pass to Output
+	PrintAfterAll bool
+
+	// PrintChanged prints the difference made by every pass which changed
+	// the program to Output
+	PrintChanged bool
+
+	// Output receives the programs printed for PrintAfterAll and
+	// PrintChanged. os.Stderr is used if it is nil.
+	Output io.Writer
+}
+
+// Remark describes a transformation made by a pass
+type Remark struct {
+	Pass     string
+	Function string
+	Pos      token.Position // the zero value if the position is unknown
+	Message  string
+}
+
+// String returns the remark without its position, e.g.
+// `function 'main': inlined call to 'f' [inline]`
+func (r Remark) String() string {
+	return fmt.Sprintf("function '%s': %s [%s]", r.Function, r.Message, r.Pass)
+}
+
+// pass represents an optimization pass which reports whether it changed
+// the program
+type pass struct {
+	name string
+	run  func(o *optimizer) bool
+}
+
+var (
+	peephole            = pass{"peephole", func(o *optimizer) bool { return forwardStores(o.program, o) }}
+	eliminateNop        = pass{"eliminate-nop", func(o *optimizer) bool { EliminateNop(o.program); return true }}
+	constantFolding     = pass{"constant-folding", func(o *optimizer) bool { return foldConstants(o.program, o) }}
+	simplify            = pass{"simplify", func(o *optimizer) bool { return simplifyProgram(o.program, o) }}
+	inline              = pass{"inline", func(o *optimizer) bool { return inlineCalls(o.program, o) }}
+	tailCallElimination = pass{"tail-call", func(o *optimizer) bool { return eliminateTailCalls(o.program, o) }}
+	gvn                 = pass{"gvn", func(o *optimizer) bool { return numberValues(o.program, o) }}
+	licm                = pass{"licm", func(o *optimizer) bool { return hoistLoopInvariants(o.program, o) }}
+	dse                 = pass{"dse", func(o *optimizer) bool { return removeDeadCode(o.program, o) }}
 )
 
-// ConstantFolding calculates all binary operation of constant value
+// optimizer contains the state while running passes. The implementations
+// of the passes report to it through warn and remark, which do nothing on a
+// nil optimizer so that the exported passes can run on their own.
+type optimizer struct {
+	program *ir.Program
+	options Options
+	err     error
+	warned  map[string]bool
+	pass    string // the name of the running pass
+}
+
+// Optimize optimizes program. An error is returned if verification is
+// enabled and the IR is malformed, in which case no further pass is run.
+func Optimize(program *ir.Program, options Options) error {
+	o := &optimizer{program: program, options: options, warned: make(map[string]bool)}
+
+	o.verify("before optimization")
+
+	if options.Level >= 1 {
+		o.local()
+		o.run(tailCallElimination)
+	}
+
+	if options.Level >= 2 {
+		if o.run(inline) {
+			// inlined bodies expose constant arguments to folding
+			o.local()
+		}
+		o.run(gvn)
+		if o.run(licm) {
+			// hoisted instructions of sibling blocks may be redundant
+			o.run(gvn)
+		}
+		o.run(dse)
+	}
+
+	return o.err
+}
+
+func (o *optimizer) local() {
+	o.run(peephole)
+	o.run(eliminateNop)
+
+	// folding and simplification expose opportunities to each other
+	for changed := true; changed; {
+		changed = o.run(constantFolding)
+		if o.run(simplify) {
+			changed = true
+		}
+		o.run(eliminateNop)
+	}
+}
+
+// run runs p unless an error has occurred and reports whether it changed
+// the program
+func (o *optimizer) run(p pass) bool {
+	if o.err != nil {
+		return false
+	}
+
+	before := ""
+	if o.options.PrintChanged {
+		before = o.program.String()
+	}
+
+	o.pass = p.name
+	changed := p.run(o)
+	o.print(p.name, before)
+	o.verify("after " + p.name)
+
+	return changed && o.err == nil
+}
+
+// print prints the program after the pass name as requested by the options
+func (o *optimizer) print(name string, before string) {
+	output := o.options.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if o.options.PrintAfterAll {
+		fmt.Fprintf(output, "*** IR after %s ***\n%s", name, o.program.String())
+	}
+	if o.options.PrintChanged {
+		fmt.Fprint(output, diff.Unified("before "+name, "after "+name, before, o.program.String()))
+	}
+}
+
+// warn reports a warning once even if passes run several times
+func (o *optimizer) warn(pos token.Position, message string) {
+	key := pos.String() + message
+	if o == nil || o.options.Warn == nil || o.warned[key] {
+		return
+	}
+	o.warned[key] = true
+	o.options.Warn(pos, message)
+}
+
+// remark reports a transformation of function made by the running pass
+func (o *optimizer) remark(function *ir.Function, pos token.Position, format string, a ...interface{}) {
+	if o == nil || o.options.Remark == nil {
+		return
+	}
+	o.options.Remark(Remark{
+		Pass:     o.pass,
+		Function: function.Node.Name,
+		Pos:      pos,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// plural returns e.g. "1 dead store" or "2 dead stores"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func (o *optimizer) verify(when string) {
+	if !o.options.VerifyIR || o.err != nil {
+		return
+	}
+
+	if errors := ir.Verify(o.program); len(errors) != 0 {
+		o.err = fmt.Errorf("invalid IR %s:\n%s", when, strings.Join(errors, "\n"))
+	}
+}
+
+// ConstantFolding replaces unary and binary operations on constants with
+// their results. Division and modulo by zero are left to fail at run time.
 func ConstantFolding(program *ir.Program) bool {
-	var changed = false
+	return foldConstants(program, nil)
+}
+
+// foldConstants implements ConstantFolding and warns about operations which
+// always fail
+func foldConstants(program *ir.Program, o *optimizer) bool {
+	changed := false
+
 	for _, function := range program.Functions {
+		// every register is defined once, so an IMM makes it constant
+		// wherever it is used
+		constants := make(map[*ir.Register]int64)
 		for _, basicBlock := range function.BasicBlocks {
-			for i := 0; i+2 < len(basicBlock.Irs); i++ {
-				ir0, ok := basicBlock.Irs[i].(*ir.ImmIr)
-				if !ok {
-					continue
-				}
-				ir1, ok := basicBlock.Irs[i+1].(*ir.ImmIr)
-				if !ok {
-					continue
-				}
-				ir2, ok := basicBlock.Irs[i+2].(*ir.BinaryOpIr)
-				if !ok {
-					continue
+			for _, instr := range basicBlock.Irs {
+				if imm, ok := instr.(*ir.ImmIr); ok {
+					constants[imm.R] = imm.Value
 				}
+			}
+		}
 
+		operands := []*ir.Register{}
+
+		for _, basicBlock := range function.BasicBlocks {
+			for i, instr := range basicBlock.Irs {
 				var result int64
-				switch ir2.Operator {
-				case "+":
-					result = ir0.Value + ir1.Value
-				case "-":
-					result = ir0.Value - ir1.Value
-				case "*":
-					result = ir0.Value * ir1.Value
-				case "/":
-					result = ir0.Value / ir1.Value
+				var err error
+
+				switch instr := instr.(type) {
+				case *ir.BinaryOpIr:
+					lhs, ok1 := constants[instr.R1]
+					rhs, ok2 := constants[instr.R2]
+					if ok2 && rhs == 0 && (instr.Operator == "/" || instr.Operator == "%") {
+						// fails whatever the dividend is
+						o.warn(instr.Pos, ir.ErrDivisionByZero.Error())
+						continue
+					}
+					if !ok1 || !ok2 {
+						continue
+					}
+					result, err = ir.EvalBinary(instr.Operator, lhs, rhs)
+					if err == nil {
+						o.remark(function, instr.Pos, "folded '%d %s %d' to %d", lhs, instr.Operator, rhs, result)
+					}
+				case *ir.UnaryOpIr:
+					value, ok := constants[instr.R1]
+					if !ok {
+						continue
+					}
+					result, err = ir.EvalUnary(instr.Operator, value)
+					if err == nil {
+						o.remark(function, token.Position{}, "folded '%s%d' to %d", instr.Operator, value, result)
+					}
+				default:
+					continue
 				}
 
-				basicBlock.Irs[i] = &ir.NopIr{}
-				basicBlock.Irs[i+1] = &ir.NopIr{}
-				basicBlock.Irs[i+2] = &ir.ImmIr{R: ir2.R0, Value: result}
+				if err != nil {
+					continue
+				}
 
+				r := ir.Def(instr)
+				operands = append(operands, ir.Uses(instr)...)
+				basicBlock.Irs[i] = &ir.ImmIr{R: r, Value: result}
+				constants[r] = result
 				changed = true
 			}
 		}
+
+		removeUnusedConstants(function, operands)
 	}
 
 	return changed
 }
 
+// removeUnusedConstants replaces the IMMs defining operands with NOP if
+// their registers are no longer used
+func removeUnusedConstants(function *ir.Function, operands []*ir.Register) {
+	if len(operands) == 0 {
+		return
+	}
+
+	used := make(map[*ir.Register]bool)
+	for _, basicBlock := range function.BasicBlocks {
+		for _, instr := range basicBlock.Irs {
+			for _, r := range ir.Uses(instr) {
+				used[r] = true
+			}
+		}
+	}
+
+	unused := make(map[*ir.Register]bool)
+	for _, r := range operands {
+		if !used[r] {
+			unused[r] = true
+		}
+	}
+
+	for _, basicBlock := range function.BasicBlocks {
+		for i, instr := range basicBlock.Irs {
+			if imm, ok := instr.(*ir.ImmIr); ok && unused[imm.R] {
+				basicBlock.Irs[i] = &ir.NopIr{}
+			}
+		}
+	}
+}
+
 // EliminateNop eliminates all NOPs
 func EliminateNop(program *ir.Program) {
 	for _, function := range program.Functions {
@@ -74,9 +341,14 @@ func EliminateNop(program *ir.Program) {
 //
 // BPREL r1, a@(rbp - 0)
 // STORE [r1] r0
-// NOP
+// BPREL r2, a@(rbp - 0)
 // MOV r3, r0
-func eliminateRedundantCode(basicBlock *ir.BasicBlock) {
+//
+// The second BPREL is kept because r2 may still be used to store back to
+// the variable (e.g. `a += 1`).
+func eliminateRedundantCode(function *ir.Function, basicBlock *ir.BasicBlock, o *optimizer) bool {
+	changed := false
+
 	for i := 0; i+3 < len(basicBlock.Irs); i++ {
 		ir0, ok := basicBlock.Irs[i].(*ir.BprelIr)
 		if !ok {
@@ -97,26 +369,105 @@ func eliminateRedundantCode(basicBlock *ir.BasicBlock) {
 		if ir0.Var != ir2.Var {
 			continue
 		}
-		basicBlock.Irs[i+2] = &ir.NopIr{}
+		if ir1.R0 != ir0.R || ir3.R1 != ir2.R {
+			continue
+		}
 		basicBlock.Irs[i+3] = &ir.MovIr{R0: ir3.R0, R1: ir1.R1}
+		o.remark(function, token.Position{}, "forwarded the value stored to '%s' to the following load", ir0.Var.Name)
+		changed = true
 	}
+	return changed
 }
 
 // Peephole does peephole optimization
 func Peephole(program *ir.Program) {
+	forwardStores(program, nil)
+}
+
+func forwardStores(program *ir.Program, o *optimizer) bool {
+	changed := false
 	for _, function := range program.Functions {
 		for _, basicBlock := range function.BasicBlocks {
-			eliminateRedundantCode(basicBlock)
+			if eliminateRedundantCode(function, basicBlock, o) {
+				changed = true
+			}
 		}
 	}
+	return changed
 }
 
-// LocalOptimize optimizes program
+// LocalOptimize optimizes program at level 1 without verification
 func LocalOptimize(program *ir.Program) {
-	Peephole(program)
-	EliminateNop(program)
+	Optimize(program, Options{Level: 1})
+}
+
+// allocator hands out register numbers and labels which are not used yet
+// in a program
+type allocator struct {
+	nextReg   int
+	nextLabel int
+}
+
+func newAllocator(program *ir.Program) *allocator {
+	a := &allocator{}
+
+	for _, function := range program.Functions {
+		for _, bb := range function.BasicBlocks {
+			if bb.Label >= a.nextLabel {
+				a.nextLabel = bb.Label + 1
+			}
+			for _, instr := range bb.Irs {
+				if r := ir.Def(instr); r != nil && r.VirtualNo >= a.nextReg {
+					a.nextReg = r.VirtualNo + 1
+				}
+			}
+		}
+	}
 
-	for ConstantFolding(program) {
-		EliminateNop(program)
+	return a
+}
+
+func (a *allocator) newRegister() *ir.Register {
+	r := &ir.Register{VirtualNo: a.nextReg}
+	a.nextReg++
+	return r
+}
+
+func (a *allocator) newBasicBlock() *ir.BasicBlock {
+	bb := &ir.BasicBlock{Label: a.nextLabel, Irs: []ir.Ir{}}
+	a.nextLabel++
+	return bb
+}
+
+// store returns the instructions which store value to variable
+func (a *allocator) store(variable *ast.Variable, value *ir.Register) []ir.Ir {
+	address := a.newRegister()
+	return []ir.Ir{
+		&ir.BprelIr{R: address, Var: variable},
+		&ir.StoreIr{R0: address, R1: value},
+	}
+}
+
+// clearVariables returns the instructions which set variables to zero
+func (a *allocator) clearVariables(variables []*ast.Variable) []ir.Ir {
+	if len(variables) == 0 {
+		return nil
+	}
+
+	zero := a.newRegister()
+	irs := []ir.Ir{&ir.ImmIr{R: zero, Value: 0}}
+	for _, variable := range variables {
+		irs = append(irs, a.store(variable, zero)...)
+	}
+
+	return irs
+}
+
+func isParameter(function *ast.Function, variable *ast.Variable) bool {
+	for _, param := range function.Parameters {
+		if param == variable {
+			return true
+		}
 	}
+	return false
 }
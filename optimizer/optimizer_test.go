@@ -0,0 +1,183 @@
+package optimizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"[f]\n.L0:\n  IMM r0, 2\n  IMM r1, 3\n  r2 = r0 < r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r2, 1\n  RET r2\n\n",
+		},
+		{
+			"[f]\n.L0:\n  IMM r0, 2\n  IMM r1, 3\n  r2 = r0 == r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r2, 0\n  RET r2\n\n",
+		},
+		{
+			"[f]\n.L0:\n  IMM r0, 2\n  IMM r1, 0\n  r2 = r0 && r1\n  r3 = r0 || r1\n  r4 = r2 + r3\n  RET r4\n",
+			"[f]\n.L0:\n  IMM r4, 1\n  RET r4\n\n",
+		},
+		{
+			"[f]\n.L0:\n  IMM r0, 5\n  r1 = ! r0\n  r2 = ~ r0\n  r3 = r1 - r2\n  RET r3\n",
+			"[f]\n.L0:\n  IMM r3, 6\n  RET r3\n\n",
+		},
+		{
+			// arithmetic wraps around
+			"[f]\n.L0:\n  IMM r0, 9223372036854775807\n  IMM r1, 1\n  r2 = r0 + r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r2, -9223372036854775808\n  RET r2\n\n",
+		},
+		{
+			"[f]\n.L0:\n  IMM r0, -9223372036854775808\n  IMM r1, -1\n  r2 = r0 / r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r2, -9223372036854775808\n  RET r2\n\n",
+		},
+		{
+			// the operands of other instructions are kept
+			"[f]\n.L0:\n  IMM r0, 1\n  IMM r1, 2\n  r2 = r0 << r1\n  PUTS r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r1, 2\n  IMM r2, 4\n  PUTS r1\n  RET r2\n\n",
+		},
+		{
+			// division by zero is left to fail at run time
+			"[f]\n.L0:\n  IMM r0, 1\n  IMM r1, 0\n  r2 = r0 % r1\n  RET r2\n",
+			"[f]\n.L0:\n  IMM r0, 1\n  IMM r1, 0\n  r2 = r0 % r1\n  RET r2\n\n",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		for ConstantFolding(program) {
+			EliminateNop(program)
+		}
+		EliminateNop(program)
+
+		if program.String() != tt.expected {
+			t.Errorf("[test-%d] wrong program. expected=\n%s\ngot=\n%s", i, tt.expected, program.String())
+		}
+	}
+}
+
+func TestDivisionByZeroWarning(t *testing.T) {
+	program := compile(t, "fn main() {\n  x = 1;\n  puts 1 / 0;\n  return x % (2 - 2);\n}")
+
+	warnings := []string{}
+	options := Options{
+		Level:    2,
+		VerifyIR: true,
+		Warn: func(pos token.Position, message string) {
+			warnings = append(warnings, pos.String()+": "+message)
+		},
+	}
+	if err := Optimize(program, options); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"3:10: division by zero", "4:12: division by zero"}
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. expected=%q, got=%q", expected, warnings)
+	}
+	for i, warning := range warnings {
+		if warning != expected[i] {
+			t.Errorf("[test-%d] wrong warning. expected=%q, got=%q", i, expected[i], warning)
+		}
+	}
+}
+
+func TestRemarks(t *testing.T) {
+	program := compile(t, "fn main() {\n  puts sq(3) * 4;\n  return 2 + 3;\n}\nfn sq(n) { return n * n; }")
+
+	remarks := []string{}
+	options := Options{
+		Level:    2,
+		VerifyIR: true,
+		Remark: func(remark Remark) {
+			remarks = append(remarks, remark.Pos.String()+": "+remark.String())
+		},
+	}
+	if err := Optimize(program, options); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		"3:12: function 'main': folded '2 + 3' to 5 [constant-folding]",
+		"2:14: function 'main': reduced 'x * 4' to shifts [simplify]",
+		"2:8: function 'main': inlined call to 'sq' [inline]",
+		"0:0: function 'main': removed 2 unreachable blocks [dse]",
+		"0:0: function 'sq': removed 1 redundant computation [gvn]",
+	}
+	for i, remark := range expected {
+		found := false
+		for _, r := range remarks {
+			if r == remark {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("[test-%d] missing remark %q in %q", i, remark, remarks)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	input := "[main]\n.L0:\n  IMM r0, 2\n  IMM r1, 3\n  r2 = r0 + r1\n  RET r2\n"
+
+	tests := []struct {
+		options  Options
+		expected string
+	}{
+		{
+			Options{Level: 1, PrintChanged: true},
+			"--- before constant-folding\n+++ after constant-folding\n@@ -1,7 +1,7 @@\n [main]\n .L0:\n" +
+				"-  IMM r0, 2\n-  IMM r1, 3\n-  r2 = r0 + r1\n+  NOP\n+  NOP\n+  IMM r2, 5\n   RET r2\n \n" +
+				"--- before eliminate-nop\n+++ after eliminate-nop\n@@ -1,7 +1,5 @@\n [main]\n .L0:\n" +
+				"-  NOP\n-  NOP\n   IMM r2, 5\n   RET r2\n \n",
+		},
+		{
+			Options{Level: 0, PrintAfterAll: true},
+			"",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		var out bytes.Buffer
+		tt.options.Output = &out
+		if err := Optimize(program, tt.options); err != nil {
+			t.Fatalf("[test-%d] unexpected error: %s", i, err)
+		}
+
+		if out.String() != tt.expected {
+			t.Errorf("[test-%d] wrong output. expected=\n%s\ngot=\n%s", i, tt.expected, out.String())
+		}
+	}
+
+	program, err := ir.Parse(input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Optimize(program, Options{Level: 2, PrintAfterAll: true, Output: &out}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range []string{"peephole", "constant-folding", "simplify", "tail-call", "inline", "gvn", "licm", "dse"} {
+		if !strings.Contains(out.String(), "*** IR after "+name+" ***\n[main]\n") {
+			t.Errorf("missing IR after %s", name)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package optimizer
+
+import (
+	"fmt"
+
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/token"
+)
+
+// identity describes an algebraic identity `x op y = z`, where y is the
+// constant rhs, or x itself if self is set, and z is x if lhs is set and the
+// constant value otherwise
+type identity struct {
+	operator string
+	self     bool
+	rhs      int64
+	lhs      bool
+	value    int64
+}
+
+// identities are applied after commutative operators have their constant
+// operand moved to the right, so `0 + x` is matched as `x + 0`.
+// `x / x` and `x % x` are missing on purpose since x may be zero.
+var identities = []identity{
+	{operator: "+", rhs: 0, lhs: true},
+	{operator: "-", rhs: 0, lhs: true},
+	{operator: "-", self: true, value: 0},
+	{operator: "*", rhs: 1, lhs: true},
+	{operator: "*", rhs: 0, value: 0},
+	{operator: "/", rhs: 1, lhs: true},
+	{operator: "%", rhs: 1, value: 0},
+	{operator: "%", rhs: -1, value: 0},
+	{operator: "&", rhs: 0, value: 0},
+	{operator: "&", rhs: -1, lhs: true},
+	{operator: "&", self: true, lhs: true},
+	{operator: "|", rhs: 0, lhs: true},
+	{operator: "|", rhs: -1, value: -1},
+	{operator: "|", self: true, lhs: true},
+	{operator: "^", rhs: 0, lhs: true},
+	{operator: "^", self: true, value: 0},
+	{operator: "<<", rhs: 0, lhs: true},
+	{operator: ">>", rhs: 0, lhs: true},
+	{operator: "==", self: true, value: 1},
+	{operator: "<", self: true, value: 0},
+	{operator: "&&", rhs: 0, value: 0},
+}
+
+// pattern returns the left-hand side of the identity, e.g. `x + 0`
+func (id identity) pattern() string {
+	if id.self {
+		return fmt.Sprintf("x %s x", id.operator)
+	}
+	return fmt.Sprintf("x %s %d", id.operator, id.rhs)
+}
+
+// result returns the right-hand side of the identity
+func (id identity) result() string {
+	if id.lhs {
+		return "x"
+	}
+	return fmt.Sprint(id.value)
+}
+
+// simplifier contains the state while simplifying a function
+type simplifier struct {
+	*allocator
+	*optimizer
+	function  *ir.Function
+	constants map[*ir.Register]int64
+	defs      map[*ir.Register]ir.Ir
+	copies    map[*ir.Register]*ir.Register
+	operands  []*ir.Register
+}
+
+// Simplify applies algebraic identities, canonicalizes the operands of
+// commutative operators so that constants come last, strips double
+// negations where only the truth of a value matters and reduces
+// multiplication, division and modulo by powers of two to shifts.
+//
+//	IMM r1, 8           IMM r3, 3
+//	r2 = r0 * r1   =>   r2 = r0 << r3
+func Simplify(program *ir.Program) bool {
+	return simplifyProgram(program, nil)
+}
+
+func simplifyProgram(program *ir.Program, o *optimizer) bool {
+	a := newAllocator(program)
+
+	changed := false
+
+	for _, function := range program.Functions {
+		s := &simplifier{
+			allocator: a,
+			optimizer: o,
+			function:  function,
+			constants: make(map[*ir.Register]int64),
+			defs:      make(map[*ir.Register]ir.Ir),
+			copies:    make(map[*ir.Register]*ir.Register),
+		}
+
+		for _, bb := range function.BasicBlocks {
+			for _, instr := range bb.Irs {
+				if r := ir.Def(instr); r != nil {
+					s.defs[r] = instr
+				}
+				if imm, ok := instr.(*ir.ImmIr); ok {
+					s.constants[imm.R] = imm.Value
+				}
+			}
+		}
+
+		for _, bb := range function.BasicBlocks {
+			irs := []ir.Ir{}
+			for _, instr := range bb.Irs {
+				simplified, ok := s.simplify(instr)
+				if !ok {
+					irs = append(irs, instr)
+					continue
+				}
+				irs = append(irs, simplified...)
+				changed = true
+			}
+			bb.Irs = irs
+		}
+
+		if len(s.copies) != 0 {
+			for _, bb := range function.BasicBlocks {
+				for _, instr := range bb.Irs {
+					ir.ReplaceUses(instr, s.copies)
+				}
+			}
+		}
+
+		ir.BuildCFG(function)
+		removeUnusedConstants(function, s.operands)
+	}
+
+	return changed
+}
+
+// simplify returns the instructions replacing instr, or false if instr is
+// kept as is
+func (s *simplifier) simplify(instr ir.Ir) ([]ir.Ir, bool) {
+	switch instr := instr.(type) {
+	case *ir.BinaryOpIr:
+		return s.simplifyBinary(instr)
+	case *ir.UnaryOpIr:
+		return s.simplifyUnary(instr)
+	case *ir.BrIr:
+		// BR (! x), a, b  =>  BR x, b, a
+		x, ok := s.negated(instr.R)
+		if !ok {
+			return nil, false
+		}
+		for {
+			instr.R = x
+			instr.Consequence, instr.Alternative = instr.Alternative, instr.Consequence
+			if x, ok = s.negated(x); !ok {
+				break
+			}
+		}
+		s.remark(s.function, token.Position{}, "branched on the operand of '!' with the targets swapped")
+		return []ir.Ir{instr}, true
+	}
+	return nil, false
+}
+
+func (s *simplifier) simplifyBinary(instr *ir.BinaryOpIr) ([]ir.Ir, bool) {
+	changed := false
+
+	if _, ok := s.constants[instr.R1]; ok && isCommutative(instr.Operator) {
+		if _, ok := s.constants[instr.R2]; !ok {
+			instr.R1, instr.R2 = instr.R2, instr.R1
+			changed = true
+		}
+	}
+
+	// only the truth of the operands of logical operators matters
+	if instr.Operator == "&&" || instr.Operator == "||" {
+		if x, ok := s.truth(instr.R1); ok {
+			s.remark(s.function, instr.Pos, "removed double negation from an operand of '%s'", instr.Operator)
+			instr.R1 = x
+			changed = true
+		}
+		if x, ok := s.truth(instr.R2); ok {
+			s.remark(s.function, instr.Pos, "removed double negation from an operand of '%s'", instr.Operator)
+			instr.R2 = x
+			changed = true
+		}
+	}
+
+	x := instr.R1
+	c, constant := s.constants[instr.R2]
+
+	for _, id := range identities {
+		if id.operator != instr.Operator {
+			continue
+		}
+		if id.self && instr.R2 != x || !id.self && (!constant || c != id.rhs) {
+			continue
+		}
+
+		s.remark(s.function, instr.Pos, "simplified '%s' to %s", id.pattern(), id.result())
+
+		s.operands = append(s.operands, instr.R1, instr.R2)
+		if id.lhs {
+			s.copy(instr.R0, x)
+			return []ir.Ir{}, true
+		}
+		return []ir.Ir{&ir.ImmIr{R: instr.R0, Value: id.value}}, true
+	}
+
+	if constant {
+		if k, ok := log2(c); ok {
+			if reduced := s.reduce(instr, k); reduced != nil {
+				s.remark(s.function, instr.Pos, "reduced 'x %s %d' to shifts", instr.Operator, c)
+				s.operands = append(s.operands, instr.R2)
+				return reduced, true
+			}
+		}
+	}
+
+	return []ir.Ir{instr}, changed
+}
+
+func (s *simplifier) simplifyUnary(instr *ir.UnaryOpIr) ([]ir.Ir, bool) {
+	def, ok := s.defs[instr.R1].(*ir.UnaryOpIr)
+	if !ok || def.Operator != instr.Operator {
+		return nil, false
+	}
+
+	switch instr.Operator {
+	case "~":
+		// ~ ~ x  =>  x
+		s.remark(s.function, token.Position{}, "simplified '~~x' to x")
+		s.copy(instr.R0, def.R1)
+		return []ir.Ir{}, true
+	case "!":
+		// ! ! ! x  =>  ! x
+		if inner, ok := s.negated(def.R1); ok {
+			s.remark(s.function, token.Position{}, "simplified '!!!x' to '!x'")
+			return []ir.Ir{&ir.UnaryOpIr{Operator: "!", R0: instr.R0, R1: inner}}, true
+		}
+	}
+	return nil, false
+}
+
+// reduce returns the instructions computing instr with shifts if its right
+// operand is 2^k, or nil
+func (s *simplifier) reduce(instr *ir.BinaryOpIr, k int64) []ir.Ir {
+	x := instr.R1
+
+	switch instr.Operator {
+	case "*":
+		// x * 2^k  =>  x << k
+		shift := s.newRegister()
+		return []ir.Ir{
+			&ir.ImmIr{R: shift, Value: k},
+			&ir.BinaryOpIr{Operator: "<<", R0: instr.R0, R1: x, R2: shift},
+		}
+	case "/":
+		return s.divide(x, k, instr.R0, s.newRegister())
+	case "%":
+		// x % 2^k  =>  x - ((x / 2^k) << k)
+		quotient, shift, product := s.newRegister(), s.newRegister(), s.newRegister()
+		return append(s.divide(x, k, quotient, shift),
+			&ir.BinaryOpIr{Operator: "<<", R0: product, R1: quotient, R2: shift},
+			&ir.BinaryOpIr{Operator: "-", R0: instr.R0, R1: x, R2: product})
+	}
+	return nil
+}
+
+// divide returns the instructions storing x / 2^k to quotient and k to
+// shift. Division rounds toward zero, so 2^k - 1 is added to negative
+// dividends before the arithmetic shift.
+//
+//	sign = x >> 63               # -1 if x is negative, otherwise 0
+//	bias = sign & (2^k - 1)
+//	quotient = (x + bias) >> k
+func (s *simplifier) divide(x *ir.Register, k int64, quotient *ir.Register, shift *ir.Register) []ir.Ir {
+	bits, sign, mask, bias, sum := s.newRegister(), s.newRegister(), s.newRegister(), s.newRegister(), s.newRegister()
+
+	return []ir.Ir{
+		&ir.ImmIr{R: bits, Value: 63},
+		&ir.BinaryOpIr{Operator: ">>", R0: sign, R1: x, R2: bits},
+		&ir.ImmIr{R: mask, Value: 1<<uint(k) - 1},
+		&ir.BinaryOpIr{Operator: "&", R0: bias, R1: sign, R2: mask},
+		&ir.BinaryOpIr{Operator: "+", R0: sum, R1: x, R2: bias},
+		&ir.ImmIr{R: shift, Value: k},
+		&ir.BinaryOpIr{Operator: ">>", R0: quotient, R1: sum, R2: shift},
+	}
+}
+
+// negated returns x if r is `! x`
+func (s *simplifier) negated(r *ir.Register) (*ir.Register, bool) {
+	def, ok := s.defs[r].(*ir.UnaryOpIr)
+	if !ok || def.Operator != "!" {
+		return nil, false
+	}
+	return def.R1, true
+}
+
+// truth returns x if r is `! ! x`, which is true exactly when x is
+func (s *simplifier) truth(r *ir.Register) (*ir.Register, bool) {
+	inner, ok := s.negated(r)
+	if !ok {
+		return nil, false
+	}
+	x, ok := s.negated(inner)
+	if !ok {
+		return nil, false
+	}
+	if y, ok := s.truth(x); ok {
+		return y, true
+	}
+	return x, true
+}
+
+// copy records that the uses of r are to be replaced with x
+func (s *simplifier) copy(r *ir.Register, x *ir.Register) {
+	if to, ok := s.copies[x]; ok {
+		x = to
+	}
+	for from, to := range s.copies {
+		if to == r {
+			s.copies[from] = x
+		}
+	}
+	s.copies[r] = x
+}
+
+// log2 returns k if v is 2^k for k >= 1
+func log2(v int64) (int64, bool) {
+	if v <= 1 || v&(v-1) != 0 {
+		return 0, false
+	}
+	k := int64(0)
+	for v > 1 {
+		v >>= 1
+		k++
+	}
+	return k, true
+}
@@ -0,0 +1,119 @@
+package optimizer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/vm"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			// x + 0 and 1 * x
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 0\n  r2 = r0 + r1\n  IMM r3, 1\n  r4 = r3 * r2\n  RET r4\n",
+			"[f]\n.L0:\n  ARGC r0\n  RET r0\n\n",
+		},
+		{
+			// x * 0, x - x and x == x
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 0\n  r2 = r0 * r1\n  r3 = r0 - r0\n  r4 = r0 == r0\n  PUTS r2\n  PUTS r3\n  RET r4\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r2, 0\n  IMM r3, 0\n  IMM r4, 1\n  PUTS r2\n  PUTS r3\n  RET r4\n\n",
+		},
+		{
+			// x / x may fail and is kept
+			"[f]\n.L0:\n  ARGC r0\n  r1 = r0 / r0\n  RET r1\n",
+			"[f]\n.L0:\n  ARGC r0\n  r1 = r0 / r0\n  RET r1\n\n",
+		},
+		{
+			// constants of commutative operators come last
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 3\n  r2 = r1 + r0\n  r3 = r1 - r0\n  r4 = r2 == r3\n  RET r4\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 3\n  r2 = r0 + r1\n  r3 = r1 - r0\n  r4 = r2 == r3\n  RET r4\n\n",
+		},
+		{
+			// ~ ~ x and ! ! ! x
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ~ r0\n  r2 = ~ r1\n  r3 = ! r2\n  r4 = ! r3\n  r5 = ! r4\n  RET r5\n",
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ~ r0\n  r3 = ! r0\n  r4 = ! r3\n  r5 = ! r0\n  RET r5\n\n",
+		},
+		{
+			// negated conditions swap the targets
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ! r0\n  BR r1, .L1, .L2\n.L1:\n  RET r0\n.L2:\n  RET r1\n",
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ! r0\n  BR r0, .L2, .L1\n.L1:\n  RET r0\n.L2:\n  RET r1\n\n",
+		},
+		{
+			// only the truth of the operands of logical operators matters
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ! r0\n  r2 = ! r1\n  GETS r3\n  r4 = r2 && r3\n  RET r4\n",
+			"[f]\n.L0:\n  ARGC r0\n  r1 = ! r0\n  r2 = ! r1\n  GETS r3\n  r4 = r0 && r3\n  RET r4\n\n",
+		},
+		{
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 8\n  r2 = r0 * r1\n  RET r2\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r3, 3\n  r2 = r0 << r3\n  RET r2\n\n",
+		},
+		{
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 4\n  r2 = r0 / r1\n  RET r2\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r4, 63\n  r5 = r0 >> r4\n  IMM r6, 3\n  r7 = r5 & r6\n  r8 = r0 + r7\n" +
+				"  IMM r3, 2\n  r2 = r8 >> r3\n  RET r2\n\n",
+		},
+		{
+			// other constants are left alone
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 6\n  r2 = r0 * r1\n  RET r2\n",
+			"[f]\n.L0:\n  ARGC r0\n  IMM r1, 6\n  r2 = r0 * r1\n  RET r2\n\n",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		Simplify(program)
+		EliminateNop(program)
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("[test-%d] wrong program. expected=\n%s\ngot=\n%s", i, tt.expected, program.String())
+		}
+	}
+}
+
+func TestStrengthReduction(t *testing.T) {
+	operators := []string{"*", "/", "%"}
+	divisors := []int64{2, 4, 8, 1024, 1 << 62}
+	values := []int64{0, 1, 7, 8, 9, -1, -7, -8, -9, 1<<63 - 1, -1 << 63}
+
+	for _, op := range operators {
+		for _, d := range divisors {
+			program, err := ir.Parse(fmt.Sprintf(
+				"[main]\n.L0:\n  GETS r0\n  IMM r1, %d\n  r2 = r0 %s r1\n  RET r2\n", d, op))
+			if err != nil {
+				t.Fatalf("parse error: %s", err)
+			}
+
+			if !Simplify(program) {
+				t.Errorf("x %s %d is not reduced", op, d)
+			}
+
+			for _, v := range values {
+				expected, _ := ir.EvalBinary(op, v, d)
+
+				exitCode, err := vm.New(program, []string{}, strings.NewReader(fmt.Sprint(v)), &bytes.Buffer{}).Run()
+				if err != nil {
+					t.Fatalf("runtime error: %s", err)
+				}
+				if exitCode != expected {
+					t.Errorf("wrong result of %d %s %d. expected=%d, got=%d", v, op, d, expected, exitCode)
+				}
+			}
+		}
+	}
+}
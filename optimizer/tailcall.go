@@ -0,0 +1,156 @@
+package optimizer
+
+import (
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+)
+
+// EliminateTailCalls turns calls of a function to itself in tail position,
+// i.e. `CALL r0, f(...)` immediately followed by `RET r0`, into a jump back
+// to the start of the function.
+//
+//	.L1:                      .L1:
+//	  STORE_ARG 0 n             STORE_ARG 0 n
+//	  ...                       JMP .L9
+//	  CALL r5, f(r4)          .L9:
+//	  RET r5                    ...
+//	                            BPREL r10, n@(rbp - 0)
+//	                            STORE [r10] r4
+//	                            JMP .L9
+//
+// The arguments are stored to the parameters and the other variables are
+// cleared, so that the function starts over as if it had been called.
+func EliminateTailCalls(program *ir.Program) bool {
+	return eliminateTailCalls(program, nil)
+}
+
+func eliminateTailCalls(program *ir.Program, o *optimizer) bool {
+	a := newAllocator(program)
+
+	changed := false
+
+	for _, function := range program.Functions {
+		if len(tailCalls(function)) == 0 {
+			continue
+		}
+
+		header := splitAfterArguments(a, function)
+		if header == nil {
+			continue
+		}
+
+		// the split may have moved calls to the header
+		sites := tailCalls(function)
+
+		locals := []*ast.Variable{}
+		for _, variable := range function.Node.Variables {
+			if !isParameter(function.Node, variable) {
+				locals = append(locals, variable)
+			}
+		}
+
+		for _, site := range sites {
+			bb, call := site.bb, site.call
+			o.remark(function, call.Pos, "turned the tail call to '%s' into a jump", call.Function)
+
+			irs := append([]ir.Ir{}, bb.Irs[:site.index]...)
+			for i, param := range function.Node.Parameters {
+				irs = append(irs, a.store(param, call.Arguments[i])...)
+			}
+			irs = append(irs, a.clearVariables(locals)...)
+			bb.Irs = append(irs, &ir.JmpIr{Target: header})
+		}
+
+		ir.BuildCFG(function)
+		changed = true
+	}
+
+	return changed
+}
+
+// tailCall is a self tail call at bb.Irs[index]
+type tailCall struct {
+	bb    *ir.BasicBlock
+	index int
+	call  *ir.CallIr
+}
+
+func tailCalls(function *ir.Function) []tailCall {
+	sites := []tailCall{}
+
+	for _, bb := range function.BasicBlocks {
+		for i, instr := range bb.Irs {
+			call, ok := instr.(*ir.CallIr)
+			if !ok || call.Function != function.Node.Name {
+				continue
+			}
+			if len(call.Arguments) != len(function.Node.Parameters) {
+				continue
+			}
+
+			// skip NOPs between CALL and RET
+			j := i + 1
+			for j < len(bb.Irs) {
+				if _, ok := bb.Irs[j].(*ir.NopIr); !ok {
+					break
+				}
+				j++
+			}
+			if j >= len(bb.Irs) {
+				continue
+			}
+
+			if ret, ok := bb.Irs[j].(*ir.RetIr); ok && ret.R == call.Return {
+				sites = append(sites, tailCall{bb: bb, index: i, call: call})
+			}
+		}
+	}
+
+	return sites
+}
+
+// splitAfterArguments splits the block storing the arguments right after
+// the last STORE_ARG and returns the new block, to which tail calls jump.
+// It returns nil if the arguments are not stored in a single block.
+func splitAfterArguments(a *allocator, function *ir.Function) *ir.BasicBlock {
+	var block *ir.BasicBlock
+	var index int
+	stored := 0
+
+	for _, bb := range function.BasicBlocks {
+		for i, instr := range bb.Irs {
+			if _, ok := instr.(*ir.StoreArgIr); !ok {
+				continue
+			}
+			if block != nil && block != bb {
+				return nil
+			}
+			block, index = bb, i+1
+			stored++
+		}
+	}
+
+	if stored != len(function.Node.Parameters) {
+		return nil
+	}
+
+	// without parameters the whole function starts over
+	if block == nil {
+		block, index = function.BasicBlocks[0], 0
+	}
+
+	header := a.newBasicBlock()
+	header.Irs = append(header.Irs, block.Irs[index:]...)
+	block.Irs = append(block.Irs[:index:index], &ir.JmpIr{Target: header})
+
+	blocks := []*ir.BasicBlock{}
+	for _, bb := range function.BasicBlocks {
+		blocks = append(blocks, bb)
+		if bb == block {
+			blocks = append(blocks, header)
+		}
+	}
+	function.BasicBlocks = blocks
+
+	return header
+}
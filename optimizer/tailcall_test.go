@@ -0,0 +1,60 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/d2verb/bee/ir"
+)
+
+func TestEliminateTailCalls(t *testing.T) {
+	tests := []struct {
+		input   string
+		changed bool
+	}{
+		{
+			"[f]\n.L0:\n  JMP .L1\n.L1:\n  STORE_ARG 0 n\n  BPREL r0, n\n  LOAD r1, [r0]\n  BR r1, .L2, .L3\n" +
+				".L2:\n  IMM r2, 1\n  r3 = r1 - r2\n  CALL r4, f(r3)\n  RET r4\n.L3:\n  RET r1\n",
+			true,
+		},
+		{
+			// the call and the parameters are in the same block
+			"[f]\n.L0:\n  STORE_ARG 0 n\n  BPREL r0, n\n  LOAD r1, [r0]\n  CALL r2, f(r1)\n  NOP\n  RET r2\n",
+			true,
+		},
+		{
+			// the result is used after the call
+			"[f]\n.L0:\n  STORE_ARG 0 n\n  BPREL r0, n\n  LOAD r1, [r0]\n  CALL r2, f(r1)\n  r3 = r2 + r1\n  RET r3\n",
+			false,
+		},
+		{
+			// another function is called
+			"[f]\n.L0:\n  IMM r0, 0\n  CALL r1, g(r0)\n  RET r1\n[g]\n.L1:\n  STORE_ARG 0 x\n  IMM r2, 0\n  RET r2\n",
+			false,
+		},
+		{
+			// another register is returned
+			"[f]\n.L0:\n  CALL r0, f()\n  ARGC r1\n  RET r1\n",
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		if changed := EliminateTailCalls(program); changed != tt.changed {
+			t.Errorf("[test-%d] wrong result. expected=%t, got=%t", i, tt.changed, changed)
+		}
+
+		if errors := ir.Verify(program); len(errors) != 0 {
+			t.Errorf("[test-%d] invalid IR: %q\n%s", i, errors, program.String())
+			continue
+		}
+
+		if tt.changed && len(tailCalls(program.Functions[0])) != 0 {
+			t.Errorf("[test-%d] tail call is left\n%s", i, program.String())
+		}
+	}
+}
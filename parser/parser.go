@@ -14,14 +14,27 @@ const (
 	LOWEST
 	ASSIGN  // =
 	AND     // && or ||
+	BITOR   // |
+	BITXOR  // ^
+	BITAND  // &
 	EQUALS  // ==
 	LESS    // <
+	SHIFT   // << >>
 	SUM     // + -
-	PRODUCT // * /
-	PREFIX  // !X
+	PRODUCT // * / %
+	PREFIX  // !X ~X
 	CALL    // myFunction(X)
 )
 
+// Precedence returns the precedence of the binary operator op, or LOWEST if
+// op is not a binary operator
+func Precedence(op string) int {
+	if p, ok := precedences[token.Type(op)]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 var precedences = map[token.Type]int{
 	token.ASSIGN:   ASSIGN,
 	token.EQ:       EQUALS,
@@ -30,6 +43,12 @@ var precedences = map[token.Type]int{
 	token.MINUS:    SUM,
 	token.DIVIDE:   PRODUCT,
 	token.MULTIPLY: PRODUCT,
+	token.MODULO:   PRODUCT,
+	token.LSHIFT:   SHIFT,
+	token.RSHIFT:   SHIFT,
+	token.BITAND:   BITAND,
+	token.BITXOR:   BITXOR,
+	token.BITOR:    BITOR,
 	token.AND:      AND,
 	token.OR:       AND,
 	token.LPAREN:   CALL,
@@ -42,8 +61,9 @@ type (
 
 // Parser represents a parser and contains the internal state
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l        *lexer.Lexer
+	errors   []string
+	comments []token.Comment
 
 	curToken  token.Token
 	peekToken token.Token
@@ -62,7 +82,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.CHAR, p.parseCharLiteral)
 	p.registerPrefix(token.NOT, p.parsePrefixExpression)
+	p.registerPrefix(token.BITNOT, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
@@ -70,6 +92,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.DIVIDE, p.parseInfixExpression)
 	p.registerInfix(token.MULTIPLY, p.parseInfixExpression)
+	p.registerInfix(token.MODULO, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.BITAND, p.parseInfixExpression)
+	p.registerInfix(token.BITXOR, p.parseInfixExpression)
+	p.registerInfix(token.BITOR, p.parseInfixExpression)
 	p.registerInfix(token.ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
@@ -93,11 +121,20 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	if !p.curTokenIs(token.EOF) && !p.l.Reported(p.curToken) {
+		msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+			token.FN, p.curToken.Type)
+		p.errors = append(p.errors, msg)
+	}
+
+	program.Comments = p.comments
+
 	return program
 }
 
 func (p *Parser) parseFunction() *ast.Function {
 	fn := &ast.Function{
+		Pos:        p.curToken.Pos,
 		Parameters: []*ast.Variable{},
 		Variables:  []*ast.Variable{},
 	}
@@ -131,7 +168,9 @@ func (p *Parser) parseFunctionParameters(fn *ast.Function) []*ast.Variable {
 		return params
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	variable := &ast.Variable{Name: p.curToken.Literal}
 
@@ -158,7 +197,7 @@ func (p *Parser) parseFunctionParameters(fn *ast.Function) []*ast.Variable {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{}
+	block := &ast.BlockStatement{Pos: p.curToken.Pos}
 	block.Statements = []ast.Statement{}
 
 	// skip `{`
@@ -176,6 +215,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		return nil
 	}
 
+	block.End = p.curToken.Pos
+
 	return block
 }
 
@@ -195,7 +236,7 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseIfStatement() *ast.IfStatement {
-	stmt := &ast.IfStatement{}
+	stmt := &ast.IfStatement{Pos: p.curToken.Pos}
 
 	// skip `if`
 	p.nextToken()
@@ -218,7 +259,7 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 }
 
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
-	stmt := &ast.WhileStatement{}
+	stmt := &ast.WhileStatement{Pos: p.curToken.Pos}
 
 	// skip `while`
 	p.nextToken()
@@ -235,7 +276,7 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 }
 
 func (p *Parser) parsePutsStatement() *ast.PutsStatement {
-	stmt := &ast.PutsStatement{}
+	stmt := &ast.PutsStatement{Pos: p.curToken.Pos}
 
 	// skip `puts`
 	p.nextToken()
@@ -245,12 +286,13 @@ func (p *Parser) parsePutsStatement() *ast.PutsStatement {
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	stmt.End = p.curToken.Pos
 
 	return stmt
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{}
+	stmt := &ast.ReturnStatement{Pos: p.curToken.Pos}
 
 	// skip `return`
 	p.nextToken()
@@ -260,27 +302,96 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	stmt.End = p.curToken.Pos
+
+	return stmt
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
+	pos := p.curToken.Pos
+	expression := p.parseExpression(LOWEST)
+
+	switch p.peekToken.Type {
+	case token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.MULTIPLY_ASSIGN, token.DIVIDE_ASSIGN:
+		p.nextToken()
+		return p.parseCompoundAssignStatement(pos, expression)
+	case token.INCREMENT, token.DECREMENT:
+		p.nextToken()
+		return p.parseIncDecStatement(pos, expression)
+	}
+
+	stmt := &ast.ExpressionStatement{Pos: pos, Expression: expression}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	stmt.End = p.curToken.Pos
+
+	return stmt
+}
+
+func (p *Parser) parseCompoundAssignStatement(pos token.Position, target ast.Expression) ast.Statement {
+	stmt := &ast.CompoundAssignStatement{
+		Pos:      pos,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	if !p.checkAssignTarget(target) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	stmt.End = p.curToken.Pos
 
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{}
+func (p *Parser) parseIncDecStatement(pos token.Position, target ast.Expression) ast.Statement {
+	stmt := &ast.IncDecStatement{
+		Pos:      pos,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
 
-	stmt.Expression = p.parseExpression(LOWEST)
+	if !p.checkAssignTarget(target) {
+		return nil
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	stmt.End = p.curToken.Pos
 
 	return stmt
 }
 
+// checkAssignTarget checks that the target of the current assignment
+// operator is assignable
+func (p *Parser) checkAssignTarget(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier:
+		return true
+	default:
+		msg := fmt.Sprintf("the left hand side of '%s' must be identifier", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return false
+	}
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
+		if !p.l.Reported(p.curToken) {
+			p.noPrefixParseFnError(p.curToken.Type)
+		}
 		return nil
 	}
 
@@ -302,15 +413,20 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Name: p.curToken.Literal}
+	return &ast.Identifier{Pos: p.curToken.Pos, Name: p.curToken.Literal}
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{}
+	lit := &ast.IntegerLiteral{Pos: p.curToken.Pos, Literal: p.curToken.Literal}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
+		var msg string
+		if numError, ok := err.(*strconv.NumError); ok && numError.Err == strconv.ErrRange {
+			msg = fmt.Sprintf("%s: integer literal %s overflows int64", p.curToken.Pos, p.curToken.Literal)
+		} else {
+			msg = fmt.Sprintf("%s: could not parse %q as integer", p.curToken.Pos, p.curToken.Literal)
+		}
 		p.errors = append(p.errors, msg)
 		return nil
 	}
@@ -320,8 +436,20 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseCharLiteral() ast.Expression {
+	value, err := lexer.UnquoteChar(p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("%s: %s", p.curToken.Pos, err)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return &ast.CharLiteral{Pos: p.curToken.Pos, Literal: p.curToken.Literal, Value: value}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
+		Pos:      p.curToken.Pos,
 		Operator: p.curToken.Literal,
 	}
 
@@ -346,19 +474,13 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
+		Pos:      p.curToken.Pos,
 		Operator: p.curToken.Literal,
 		Left:     left,
 	}
 
-	if p.curToken.Type == token.ASSIGN {
-		switch left.(type) {
-		case *ast.Identifier:
-			break
-		default:
-			msg := fmt.Sprintf("the left hand side of '=' must be identifier")
-			p.errors = append(p.errors, msg)
-			return nil
-		}
+	if p.curToken.Type == token.ASSIGN && !p.checkAssignTarget(left) {
+		return nil
 	}
 
 	precedence := p.curPrecedence()
@@ -373,6 +495,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 
 	switch node := function.(type) {
 	case *ast.Identifier:
+		exp.Pos = node.Pos
 		exp.Function = node.Name
 		break
 	default:
@@ -440,10 +563,13 @@ func (p *Parser) curPrecedence() int {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.comments = append(p.comments, p.peekToken.Comments...)
 }
 
+// Errors returns errors of lexer and parser
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := append([]string{}, p.l.Errors()...)
+	return append(errors, p.errors...)
 }
 
 func (p *Parser) curTokenIs(t token.Type) bool {
@@ -454,7 +580,12 @@ func (p *Parser) peekTokenIs(t token.Type) bool {
 	return p.peekToken.Type == t
 }
 
+// peekError reports that the next token is not t unless the lexer has
+// already reported it as illegal
 func (p *Parser) peekError(t token.Type) {
+	if p.l.Reported(p.peekToken) {
+		return
+	}
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
@@ -464,6 +595,9 @@ func (p *Parser) expect(t token.Type) bool {
 	if p.curTokenIs(t) {
 		return true
 	}
+	if p.l.Reported(p.curToken) {
+		return false
+	}
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.curToken.Type)
 	p.errors = append(p.errors, msg)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/d2verb/bee/ast"
 	"github.com/d2verb/bee/lexer"
 )
 
@@ -53,6 +54,56 @@ func TestAssignExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestCompoundAssignStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn main(){ x += 5; }", "fn main(){x+=5;}"},
+		{"fn main(){ x -= y * 2; }", "fn main(){x-=(y*2);}"},
+		{"fn main(){ x *= 2 x /= 2 }", "fn main(){x*=2;x/=2;}"},
+		{"fn main(){ x++; y--; }", "fn main(){x++;y--;}"},
+		{"fn main(){ x++ y-- }", "fn main(){x++;y--;}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestAssignTargetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn main(){ 1 = 2; }", "the left hand side of '=' must be identifier"},
+		{"fn main(){ 1 += 2; }", "the left hand side of '+=' must be identifier"},
+		{"fn main(){ f()++; }", "the left hand side of '++' must be identifier"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("expected error %q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -114,6 +165,12 @@ func TestInfixExpressions(t *testing.T) {
 		{"fn main(){ 5 < 5; }", "fn main(){(5<5);}"},
 		{"fn main(){ 5 && 5; }", "fn main(){(5&&5);}"},
 		{"fn main(){ 5 || 5; }", "fn main(){(5||5);}"},
+		{"fn main(){ 5 % 5; }", "fn main(){(5%5);}"},
+		{"fn main(){ 5 & 5; }", "fn main(){(5&5);}"},
+		{"fn main(){ 5 | 5; }", "fn main(){(5|5);}"},
+		{"fn main(){ 5 ^ 5; }", "fn main(){(5^5);}"},
+		{"fn main(){ 5 << 5; }", "fn main(){(5<<5);}"},
+		{"fn main(){ 5 >> 5; }", "fn main(){(5>>5);}"},
 	}
 
 	for _, tt := range tests {
@@ -150,6 +207,15 @@ func TestOperatorPrecedence(t *testing.T) {
 		{"fn main(){ 1 + 0 || 3 < 4; }", "fn main(){((1+0)||(3<4));}"},
 		{"fn main(){ x < a && x == y; }", "fn main(){((x<a)&&(x==y));}"},
 		{"fn main(){ x = a < 5 && x == y; }", "fn main(){(x=((a<5)&&(x==y)));}"},
+		{"fn main(){ a * b % c; }", "fn main(){((a*b)%c);}"},
+		{"fn main(){ a + b % c; }", "fn main(){(a+(b%c));}"},
+		{"fn main(){ a << b + c; }", "fn main(){(a<<(b+c));}"},
+		{"fn main(){ a < b >> c; }", "fn main(){(a<(b>>c));}"},
+		{"fn main(){ a & b == c; }", "fn main(){(a&(b==c));}"},
+		{"fn main(){ a | b ^ c & d; }", "fn main(){(a|(b^(c&d)));}"},
+		{"fn main(){ a && b | c; }", "fn main(){(a&&(b|c));}"},
+		{"fn main(){ ~a + b; }", "fn main(){(~(a)+b);}"},
+		{"fn main(){ ~a & ~b; }", "fn main(){(~(a)&~(b));}"},
 	}
 
 	for _, tt := range tests {
@@ -239,6 +305,196 @@ func TestTrailingSemicolon(t *testing.T) {
 	}
 }
 
+func TestIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn main(){ puts 0x1F; }", "fn main(){puts 31;}"},
+		{"fn main(){ puts 0XfF; }", "fn main(){puts 255;}"},
+		{"fn main(){ puts 0o17; }", "fn main(){puts 15;}"},
+		{"fn main(){ puts 0b1010; }", "fn main(){puts 10;}"},
+		{"fn main(){ puts 1_000_000; }", "fn main(){puts 1000000;}"},
+		{"fn main(){ puts 0x_ff_ff; }", "fn main(){puts 65535;}"},
+		{"fn main(){ puts 9223372036854775807; }", "fn main(){puts 9223372036854775807;}"},
+		{"fn main(){ x1 = y2; }", "fn main(){(x1=y2);}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn main(){ puts 9223372036854775808; }", "1:17: integer literal 9223372036854775808 overflows int64"},
+		{"fn main(){\n  puts 0x8000_0000_0000_0000; }", "2:8: integer literal 0x8000_0000_0000_0000 overflows int64"},
+		{"fn main(){ puts 0b102; }", "1:17: could not parse \"0b102\" as integer"},
+		{"fn main(){ puts 1__0; }", "1:17: could not parse \"1__0\" as integer"},
+		{"fn main(){ puts 12ab; }", "1:17: could not parse \"12ab\" as integer"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("expected error %q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
+func TestCharLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		value    rune
+	}{
+		{"fn main(){ puts 'a'; }", "fn main(){puts 'a';}", 'a'},
+		{"fn main(){ puts 'é'; }", "fn main(){puts 'é';}", 'é'},
+		{`fn main(){ puts '\n'; }`, `fn main(){puts '\n';}`, '\n'},
+		{`fn main(){ puts '\0'; }`, `fn main(){puts '\0';}`, 0},
+		{`fn main(){ puts '\x41'; }`, "fn main(){puts 'A';}", 'A'},
+		{`fn main(){ puts '\x7f'; }`, `fn main(){puts '\x7f';}`, 0x7f},
+		{`fn main(){ puts '\u{200b}'; }`, `fn main(){puts '\u{200b}';}`, 0x200b},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+
+		stmt := program.Functions[0].Body.Statements[0].(*ast.PutsStatement)
+		literal, ok := stmt.Value.(*ast.CharLiteral)
+		if !ok {
+			t.Errorf("expected *ast.CharLiteral, got=%T", stmt.Value)
+			continue
+		}
+		if literal.Value != tt.value {
+			t.Errorf("wrong value. expected=%d, got=%d", tt.value, literal.Value)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `
+// entry point
+fn main() {
+	x = 6 / /* divisor */ 2; // three
+	/* puts x; */
+	puts x;
+}`
+	expected := "fn main(){(x=(6/2));puts x;}"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	actual := program.String()
+	if actual != expected {
+		t.Errorf("expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	input := "fn main(1) {}"
+	expected := "expected next token to be IDENT, got INT instead"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != expected {
+		t.Errorf("expected error %q, got=%q", expected, errors)
+	}
+}
+
+func TestTrailingGarbage(t *testing.T) {
+	input := "fn main() {} puts 1;"
+	expected := "expected next token to be FN, got PUTS instead"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != expected {
+		t.Errorf("expected error %q, got=%q", expected, errors)
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	input := "fn main() { puts 1; } /* unterminated"
+	expected := "1:23: unterminated block comment"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != expected {
+		t.Errorf("expected error %q, got=%q", expected, errors)
+	}
+}
+
+// TestIllegalTokens checks that tokens reported as illegal by the lexer are
+// not reported again by the parser
+func TestIllegalTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn main() { puts 'ab'; }", "1:18: character literal 'ab' has more than one character"},
+		{`fn main() { puts '\q'; }`, `1:18: unknown escape sequence "\\q"`},
+		{"fn main() { x = 'ab' + 1; puts x; }", "1:17: character literal 'ab' has more than one character"},
+		{"\xff", "1:1: invalid UTF-8 encoding"},
+		{"fn main() { puts 1; }\xff", "1:22: invalid UTF-8 encoding"},
+		{"fn main() { x = 1 \xff 2; }", "1:19: invalid UTF-8 encoding"},
+		// the lexer does not report a lone '>'
+		{"fn main() { x = 1 > 2; }", "no prefix parse function for ILLEGAL found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("expected error %q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -250,3 +506,31 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func FuzzParseProgram(f *testing.F) {
+	f.Add("fn main() { x = 1 + 2 * 3; puts x; return x; }")
+	f.Add("fn main() { if (x < y) { x += 1; } else { y--; } while (!x) { puts ~x & 0xff; } }")
+	f.Add("fn add(x, y) { return x + y; } fn main() { return add(1, 'a'); }")
+	f.Add("fn main() { x = (1 + ; }")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		// the debug output must parse back to the same tree
+		printed := program.String()
+
+		p = New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if errors := p.Errors(); len(errors) != 0 {
+			t.Fatalf("%q printed as %q which does not parse: %q", input, printed, errors)
+		}
+
+		if reparsed.String() != printed {
+			t.Fatalf("%q printed as %q which parses to %q", input, printed, reparsed.String())
+		}
+	})
+}
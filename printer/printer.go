@@ -0,0 +1,337 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/lexer"
+	"github.com/d2verb/bee/parser"
+	"github.com/d2verb/bee/token"
+)
+
+// indent is the string used for one level of indentation
+const indent = "    "
+
+// endOfFile is a position after all elements and comments
+var endOfFile = token.Position{Line: int(^uint(0) >> 1)}
+
+// printer represents a pretty-printer and contains the internal state
+type printer struct {
+	out      bytes.Buffer
+	depth    int
+	comments []token.Comment
+	next     int  // index of the next comment to print
+	lastLine int  // source line of the last printed element
+	noBlank  bool // suppress a blank line before the next element
+}
+
+// Fprint writes the canonically formatted source of program to w.
+// Comments in program.Comments are preserved: comments on the same line as
+// the end of a statement, and before the next one, are kept at the end of the
+// line, and all others are printed on their own line before the following
+// statement.
+func Fprint(w io.Writer, program *ast.Program) error {
+	p := &printer{comments: program.Comments}
+
+	p.printProgram(program)
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+// Source parses src and returns the canonically formatted source
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	ps := parser.New(l)
+
+	program := ps.ParseProgram()
+	if errors := ps.Errors(); len(errors) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errors, "\n"))
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// Node returns the source of node which parses back to the same tree.
+// Unlike the String methods of the AST, which are meant for debugging, only
+// required parentheses are printed and literals keep their spelling.
+// Comments are printed only for *ast.Program.
+func Node(node ast.Node) string {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+		p.printProgram(node)
+	case *ast.Function:
+		p.printFunction(node, endOfFile)
+	case ast.Statement:
+		p.printStatement(node, endOfFile)
+	case ast.Expression:
+		return expression(node)
+	}
+
+	return p.out.String()
+}
+
+func (p *printer) printProgram(program *ast.Program) {
+	for i, function := range program.Functions {
+		if i > 0 {
+			// exactly one blank line between functions
+			p.write("\n")
+			p.noBlank = true
+		}
+
+		next := endOfFile
+		if i+1 < len(program.Functions) {
+			next = program.Functions[i+1].Pos
+		}
+		p.printFunction(function, next)
+	}
+
+	p.printComments(endOfFile)
+}
+
+// printFunction prints function, which is followed by an element at next
+func (p *printer) printFunction(function *ast.Function, next token.Position) {
+	p.printComments(function.Pos)
+	p.beginLine(function.Pos.Line)
+
+	params := []string{}
+	for _, variable := range function.Parameters {
+		params = append(params, variable.Name)
+	}
+
+	p.write(fmt.Sprintf("fn %s(%s) ", function.Name, strings.Join(params, ", ")))
+	p.printBlock(function.Body)
+	p.printTrailingComments(function.Body.End, next)
+	p.write("\n")
+}
+
+func (p *printer) printBlock(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.hasCommentBefore(block.End) {
+		p.write("{}")
+		p.lastLine = block.End.Line
+		return
+	}
+
+	p.write("{\n")
+	p.lastLine = block.Pos.Line
+	p.noBlank = true
+	p.depth++
+
+	for i, statement := range block.Statements {
+		next := block.End
+		if i+1 < len(block.Statements) {
+			next = statementPos(block.Statements[i+1])
+		}
+		p.printStatement(statement, next)
+	}
+	p.printComments(block.End)
+
+	p.depth--
+	p.writeIndent()
+	p.write("}")
+	p.lastLine = block.End.Line
+}
+
+// printStatement prints node, which is followed by an element at next
+func (p *printer) printStatement(node ast.Statement, next token.Position) {
+	pos := statementPos(node)
+
+	p.printComments(pos)
+	p.beginLine(pos.Line)
+
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		p.write(expression(node.Expression) + ";")
+	case *ast.ReturnStatement:
+		p.write("return " + expression(node.Value) + ";")
+	case *ast.PutsStatement:
+		p.write("puts " + expression(node.Value) + ";")
+	case *ast.CompoundAssignStatement:
+		p.write(fmt.Sprintf("%s %s %s;",
+			expression(node.Target), node.Operator, expression(node.Value)))
+	case *ast.IncDecStatement:
+		p.write(expression(node.Target) + node.Operator + ";")
+	case *ast.IfStatement:
+		p.write("if " + expression(node.Condition) + " ")
+		p.printBlock(node.Consequence)
+		if node.Alternative != nil {
+			p.write(" else ")
+			p.printBlock(node.Alternative)
+		}
+	case *ast.WhileStatement:
+		p.write("while " + expression(node.Condition) + " ")
+		p.printBlock(node.Body)
+	case *ast.BlockStatement:
+		p.printBlock(node)
+	}
+
+	end := statementEnd(node)
+
+	p.printTrailingComments(end, next)
+	p.write("\n")
+	p.lastLine = end.Line
+}
+
+// printComments prints all remaining comments before pos on their own lines
+func (p *printer) printComments(pos token.Position) {
+	for p.hasCommentBefore(pos) {
+		comment := p.comments[p.next]
+		p.next++
+
+		p.beginLine(comment.Pos.Line)
+		p.write(comment.Text + "\n")
+		p.lastLine = comment.Pos.Line + strings.Count(comment.Text, "\n")
+	}
+}
+
+// printTrailingComments prints remaining comments which start at or before
+// the line of end, the end of the element just printed, and before next, the
+// start of the following element, at the end of the current line. Comments
+// after the following element on the same line belong to that element.
+func (p *printer) printTrailingComments(end, next token.Position) {
+	for p.next < len(p.comments) && p.comments[p.next].Pos.Line <= end.Line &&
+		p.hasCommentBefore(next) {
+		comment := p.comments[p.next]
+		p.next++
+
+		p.write(" " + comment.Text)
+
+		// nothing can follow a line comment on the same line
+		if strings.HasPrefix(comment.Text, "//") {
+			break
+		}
+	}
+}
+
+func (p *printer) hasCommentBefore(pos token.Position) bool {
+	if p.next >= len(p.comments) {
+		return false
+	}
+	c := p.comments[p.next].Pos
+	return c.Line < pos.Line || c.Line == pos.Line && c.Column < pos.Column
+}
+
+// beginLine starts a new line for an element at line in the source.
+// A single blank line in the source before the element is preserved.
+func (p *printer) beginLine(line int) {
+	if !p.noBlank && p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("\n")
+	}
+	p.noBlank = false
+	p.writeIndent()
+}
+
+func (p *printer) writeIndent() {
+	p.write(strings.Repeat(indent, p.depth))
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func expression(node ast.Expression) string {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return node.Name
+	case *ast.IntegerLiteral:
+		if node.Literal != "" {
+			return node.Literal
+		}
+		return node.String()
+	case *ast.CharLiteral:
+		if node.Literal != "" {
+			return node.Literal
+		}
+		return node.String()
+	case *ast.PrefixExpression:
+		return node.Operator + operand(node.Right, parser.PREFIX, false)
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(node.Operator)
+		return fmt.Sprintf("%s %s %s",
+			operand(node.Left, precedence, false),
+			node.Operator,
+			operand(node.Right, precedence, true))
+	case *ast.CallExpression:
+		args := []string{}
+		for _, argument := range node.Arguments {
+			args = append(args, expression(argument))
+		}
+		return fmt.Sprintf("%s(%s)", node.Function, strings.Join(args, ", "))
+	}
+	return ""
+}
+
+// operand returns the source of an operand of an operator with precedence.
+// Parentheses are added only when they are required to keep the tree, since
+// all binary operators are left-associative.
+func operand(node ast.Expression, precedence int, right bool) string {
+	s := expression(node)
+
+	if infix, ok := node.(*ast.InfixExpression); ok {
+		p := parser.Precedence(infix.Operator)
+		if p < precedence || right && p == precedence {
+			return "(" + s + ")"
+		}
+	}
+
+	return s
+}
+
+// statementEnd returns the position of the last token of node
+func statementEnd(node ast.Statement) token.Position {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return node.End
+	case *ast.ReturnStatement:
+		return node.End
+	case *ast.PutsStatement:
+		return node.End
+	case *ast.CompoundAssignStatement:
+		return node.End
+	case *ast.IncDecStatement:
+		return node.End
+	case *ast.IfStatement:
+		if node.Alternative != nil {
+			return node.Alternative.End
+		}
+		return node.Consequence.End
+	case *ast.WhileStatement:
+		return node.Body.End
+	case *ast.BlockStatement:
+		return node.End
+	}
+	return token.Position{}
+}
+
+func statementPos(node ast.Statement) token.Position {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return node.Pos
+	case *ast.ReturnStatement:
+		return node.Pos
+	case *ast.PutsStatement:
+		return node.Pos
+	case *ast.CompoundAssignStatement:
+		return node.Pos
+	case *ast.IncDecStatement:
+		return node.Pos
+	case *ast.IfStatement:
+		return node.Pos
+	case *ast.WhileStatement:
+		return node.Pos
+	case *ast.BlockStatement:
+		return node.Pos
+	}
+	return token.Position{}
+}
@@ -0,0 +1,261 @@
+package printer
+
+import (
+	"testing"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/lexer"
+	"github.com/d2verb/bee/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"fn main(){}",
+			"fn main() {}\n",
+		},
+		{
+			"fn main(){ x=1+2*3; puts (x) ;return x }",
+			"fn main() {\n    x = 1 + 2 * 3;\n    puts x;\n    return x;\n}\n",
+		},
+		{
+			"fn add(x,y){return x+y;} fn main(){return add(1,2);}",
+			"fn add(x, y) {\n    return x + y;\n}\n\nfn main() {\n    return add(1, 2);\n}\n",
+		},
+		{
+			"fn main(){ if (x<y) {x=x+1;} else {puts 1;} while(i<10){i++; j-=1;} }",
+			"fn main() {\n" +
+				"    if x < y {\n        x = x + 1;\n    } else {\n        puts 1;\n    }\n" +
+				"    while i < 10 {\n        i++;\n        j -= 1;\n    }\n" +
+				"}\n",
+		},
+		{
+			"fn main(){ puts (a+b)*c; puts a-(b-c); puts (a-b)-c; puts !(a&&b); puts !!a; puts ~(a|b)&c; }",
+			"fn main() {\n" +
+				"    puts (a + b) * c;\n" +
+				"    puts a - (b - c);\n" +
+				"    puts a - b - c;\n" +
+				"    puts !(a && b);\n" +
+				"    puts !!a;\n" +
+				"    puts ~(a | b) & c;\n" +
+				"}\n",
+		},
+		{
+			"fn main(){ puts 0xff + 0b1_0 + '\\n' + 'é'; }",
+			"fn main() {\n    puts 0xff + 0b1_0 + '\\n' + 'é';\n}\n",
+		},
+		{
+			"fn main() {\n\n\n    x = 1;\n\n\n    y = 2;\n    z = 3;\n\n}\n",
+			"fn main() {\n    x = 1;\n\n    y = 2;\n    z = 3;\n}\n",
+		},
+	}
+
+	for i, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if string(actual) != tt.expected {
+			t.Errorf("[test-%d] wrong output. expected=\n%s\ngot=\n%s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// Package comment
+
+// add returns the sum
+fn add(x, y) { // after brace
+  // leading
+  return x + y; // trailing
+  /* before brace */
+}
+fn main() {
+    x = 6 / /* divisor */ 2;
+    if x < 3 {
+    } // after if
+    /* a */ /* b */ puts x;
+    while x { x-- }
+}
+// end of file
+`
+	expected := `// Package comment
+
+// add returns the sum
+fn add(x, y) {
+    // after brace
+    // leading
+    return x + y; // trailing
+    /* before brace */
+}
+
+fn main() {
+    x = 6 / 2; /* divisor */
+    if x < 3 {} // after if
+    /* a */
+    /* b */
+    puts x;
+    while x {
+        x--;
+    }
+}
+// end of file
+`
+
+	actual, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(actual) != expected {
+		t.Errorf("wrong output. expected=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestTrailingComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"fn main() {\n    x = 1; y = 2; // about y\n}\n",
+			"fn main() {\n    x = 1;\n    y = 2; // about y\n}\n",
+		},
+		{
+			"fn main() {\n    x = 1; /* about x */ y = 2;\n}\n",
+			"fn main() {\n    x = 1; /* about x */\n    y = 2;\n}\n",
+		},
+		{
+			"fn main() {\n    if x < y { puts x; } // after if\n}\n",
+			"fn main() {\n    if x < y {\n        puts x;\n    } // after if\n}\n",
+		},
+		{
+			"fn main() {\n    while x { x--; } y = 1; // after assignment\n}\n",
+			"fn main() {\n    while x {\n        x--;\n    }\n    y = 1; // after assignment\n}\n",
+		},
+		{
+			"fn f(a,b){return a+b;} // c\nfn main(){ return f(1, 2); }\n",
+			"fn f(a, b) {\n    return a + b;\n} // c\n\nfn main() {\n    return f(1, 2);\n}\n",
+		},
+		{
+			"fn main() {\n    x = 1 +\n        2; // end\n}\n",
+			"fn main() {\n    x = 1 + 2; // end\n}\n",
+		},
+	}
+
+	for i, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if string(actual) != tt.expected {
+			t.Errorf("[test-%d] wrong output. expected=\n%s\ngot=\n%s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	inputs := []string{
+		"fn main(){ x=1; /* a */ // b\n y = 2; }",
+		"fn main(){ x = 1 +\n // inside\n 2; // end\n}",
+		"fn main() { if x /* c */ {} else { // d\n } }",
+		"// only a comment",
+		"fn a(){}\n// between\nfn main(){}\n\n\n/* tail */",
+	}
+
+	for i, input := range inputs {
+		first, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		second, err := Source(first)
+		if err != nil {
+			t.Errorf("[test-%d] formatted output does not parse: %s\n%s", i, err, first)
+			continue
+		}
+
+		if string(first) != string(second) {
+			t.Errorf("[test-%d] not idempotent. first=\n%s\nsecond=\n%s", i, first, second)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("fn main() { puts ; }"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestNode(t *testing.T) {
+	input := "fn main() { x = (1 + 2) * 3; if x { puts !(x - 1); } }"
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %q", errors)
+	}
+
+	function := program.Functions[0]
+	assign := function.Body.Statements[0].(*ast.ExpressionStatement)
+	ifStatement := function.Body.Statements[1].(*ast.IfStatement)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{assign.Expression, "x = (1 + 2) * 3"},
+		{assign, "x = (1 + 2) * 3;\n"},
+		{ifStatement, "if x {\n    puts !(x - 1);\n}\n"},
+		{function, "fn main() {\n    x = (1 + 2) * 3;\n    if x {\n        puts !(x - 1);\n    }\n}\n"},
+	}
+
+	for i, tt := range tests {
+		actual := Node(tt.node)
+		if actual != tt.expected {
+			t.Errorf("[test-%d] wrong output. expected=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+}
+
+func FuzzNode(f *testing.F) {
+	f.Add("fn main() { x = (1 + 2) * 3; puts x; return x; }")
+	f.Add("// c\nfn main() { if x < y { x += 1; } else { y--; } /* d */ while !x { puts ~x & 0xff; } }")
+	f.Add("fn add(x, y) { return x - (y - 1); } fn main() { return add(1, '\\n'); }")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		printed := Node(program)
+
+		p = parser.New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if errors := p.Errors(); len(errors) != 0 {
+			t.Fatalf("%q printed as %q which does not parse: %q", input, printed, errors)
+		}
+
+		// the same tree
+		if reparsed.String() != program.String() {
+			t.Fatalf("%q printed as %q which parses to a different tree %q",
+				input, printed, reparsed.String())
+		}
+
+		// print -> parse -> print is stable
+		if Node(reparsed) != printed {
+			t.Fatalf("%q printed as %q and then as %q", input, printed, Node(reparsed))
+		}
+	})
+}
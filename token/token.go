@@ -1,12 +1,35 @@
 package token
 
+import "fmt"
+
 // Type represents the type of token
 type Type string
 
+// Position represents a location in the source code
+type Position struct {
+	Line   int // starting at 1
+	Column int // starting at 1
+}
+
+// String returns the position in `line:column` form
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Comment holds a comment and its position
+type Comment struct {
+	Text string // including `//` or `/* */`
+	Pos  Position
+}
+
 // Token holds a single token type and its literal value
 type Token struct {
 	Type    Type
 	Literal string
+	Pos     Position
+
+	// Comments preceding the token, kept as trivia for tools like formatters
+	Comments []Comment
 }
 
 const (
@@ -22,12 +45,28 @@ const (
 	// INT an integer, e.g: 1234
 	INT = "INT"
 
+	// CHAR a character literal, e.g: 'a'
+	CHAR = "CHAR"
+
 	//
 	// Operators
 	//
 
 	// ASSIGN the assignment operator
 	ASSIGN = "="
+	// PLUS_ASSIGN the addition assignment operator
+	PLUS_ASSIGN = "+="
+	// MINUS_ASSIGN the subtraction assignment operator
+	MINUS_ASSIGN = "-="
+	// MULTIPLY_ASSIGN the multiplication assignment operator
+	MULTIPLY_ASSIGN = "*="
+	// DIVIDE_ASSIGN the division assignment operator
+	DIVIDE_ASSIGN = "/="
+
+	// INCREMENT the increment operator
+	INCREMENT = "++"
+	// DECREMENT the decrement operator
+	DECREMENT = "--"
 
 	// PLUS the addition operator
 	PLUS = "+"
@@ -41,6 +80,26 @@ const (
 	// DEVIDE the division operator
 	DIVIDE = "/"
 
+	// MODULO the remainder operator
+	MODULO = "%"
+
+	//
+	// Bitwise operators
+	//
+
+	// BITAND the bitwise and operator
+	BITAND = "&"
+	// BITOR the bitwise or operator
+	BITOR = "|"
+	// BITXOR the bitwise exclusive or operator
+	BITXOR = "^"
+	// BITNOT the bitwise not operator
+	BITNOT = "~"
+	// LSHIFT the left shift operator
+	LSHIFT = "<<"
+	// RSHIFT the arithmetic right shift operator
+	RSHIFT = ">>"
+
 	//
 	// Logical operators
 	//
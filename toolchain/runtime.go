@@ -0,0 +1,180 @@
+package toolchain
+
+// RuntimeSource is the C source of the runtime linked into native
+// executables. It provides the built-in functions of bee and `main`, which
+// calls `bee_main` and exits with its return value. Errors are reported
+// like the VM does and terminate the program with status 1.
+//
+// Its functions are either named after built-in functions, which cannot be
+// redefined, or contain an underscore followed by a letter other than u,
+// which Symbol never produces.
+const RuntimeSource = `#include <ctype.h>
+#include <stdarg.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+long long bee_main(void);
+
+static int bee_argc_value;
+static char **bee_argv_value;
+static int bee_eof_flag;
+
+static void bee_rt_error(const char *format, ...) {
+	va_list ap;
+
+	fflush(stdout);
+	fprintf(stderr, "Error: ");
+	va_start(ap, format);
+	vfprintf(stderr, format, ap);
+	va_end(ap);
+	fprintf(stderr, "\n");
+	exit(1);
+}
+
+/* parse_integer parses s as a whole like strconv.ParseInt(s, 0, 64): an
+   optional sign, an optional 0b, 0o, 0x or 0 prefix for the base and digits
+   which may be separated by single underscores. Unlike strtoll, it accepts
+   no whitespace and no underscores out of place. */
+static int parse_integer(const char *s, long long *value) {
+	unsigned long long n = 0, limit = 9223372036854775807ULL;
+	int negative = 0, base = 10, digits = 0;
+	char last = '^'; /* '0' after a digit or a prefix, '_' after an underscore */
+
+	if (*s == '+' || *s == '-') {
+		negative = *s == '-';
+		if (negative) {
+			limit++;
+		}
+		s++;
+	}
+
+	if (s[0] == '0') {
+		switch (s[1]) {
+		case 'b': case 'B':
+			base = 2;
+			break;
+		case 'o': case 'O':
+			base = 8;
+			break;
+		case 'x': case 'X':
+			base = 16;
+			break;
+		}
+		if (base != 10) {
+			s += 2;
+			last = '0';
+		} else {
+			/* the leading 0 of an octal number is also a digit */
+			base = 8;
+		}
+	}
+
+	for (; *s != '\0'; s++) {
+		int digit;
+
+		if (*s == '_') {
+			if (last != '0') {
+				return 0;
+			}
+			last = '_';
+			continue;
+		}
+
+		if ('0' <= *s && *s <= '9') {
+			digit = *s - '0';
+		} else if ('a' <= *s && *s <= 'f') {
+			digit = *s - 'a' + 10;
+		} else if ('A' <= *s && *s <= 'F') {
+			digit = *s - 'A' + 10;
+		} else {
+			return 0;
+		}
+		if (digit >= base || n > (limit - digit) / base) {
+			return 0;
+		}
+
+		n = n * base + digit;
+		last = '0';
+		digits++;
+	}
+
+	if (digits == 0 || last == '_') {
+		return 0;
+	}
+
+	*value = negative && n > 0 ? -(long long)(n - 1) - 1 : (long long)n;
+	return 1;
+}
+
+void bee_division_by_zero(void) {
+	bee_rt_error("division by zero");
+}
+
+long long bee_puts(long long value) {
+	printf("%lld\n", value);
+	return 0;
+}
+
+long long bee_argc(void) {
+	return bee_argc_value;
+}
+
+long long bee_arg(long long index) {
+	long long value;
+
+	if (index < 0 || index >= bee_argc_value) {
+		bee_rt_error("argument index %lld out of range", index);
+	}
+	if (!parse_integer(bee_argv_value[index], &value)) {
+		bee_rt_error("argument %lld (\"%s\") is not an integer", index, bee_argv_value[index]);
+	}
+	return value;
+}
+
+/* bee_gets reads the next whitespace separated integer from stdin. At the
+   end of input it returns 0 and sets the EOF flag. */
+long long bee_gets(void) {
+	static char *buffer;
+	static size_t capacity;
+	size_t length = 0;
+	long long value;
+	int c;
+
+	do {
+		c = getchar();
+	} while (c != EOF && isspace(c));
+
+	if (c == EOF) {
+		bee_eof_flag = 1;
+		return 0;
+	}
+
+	while (c != EOF && !isspace(c)) {
+		if (length + 1 >= capacity) {
+			capacity = capacity ? capacity * 2 : 32;
+			buffer = realloc(buffer, capacity);
+			if (buffer == NULL) {
+				bee_rt_error("out of memory");
+			}
+		}
+		buffer[length++] = (char)c;
+		c = getchar();
+	}
+	buffer[length] = '\0';
+
+	if (!parse_integer(buffer, &value)) {
+		bee_rt_error("input \"%s\" is not an integer", buffer);
+	}
+	return value;
+}
+
+long long bee_eof(void) {
+	return bee_eof_flag;
+}
+
+int main(int argc, char **argv) {
+	bee_argc_value = argc - 1;
+	bee_argv_value = argv + 1;
+	return (int)bee_main();
+}
+`
@@ -0,0 +1,111 @@
+package toolchain
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Symbol returns the symbol of the bee function name in the generated
+// assembly or C. It is prefixed with "bee_" so that it does not clash with
+// the C library, underscores are doubled and characters other than ASCII
+// letters and digits are written as _uXXXX_, so that it never clashes with
+// the runtime either.
+func Symbol(name string) string {
+	var out strings.Builder
+	out.WriteString("bee_")
+	for _, ch := range name {
+		switch {
+		case ch == '_':
+			out.WriteString("__")
+		case 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9':
+			out.WriteRune(ch)
+		default:
+			fmt.Fprintf(&out, "_u%04x_", ch)
+		}
+	}
+	return out.String()
+}
+
+// Toolchain holds the external commands used to build native executables
+type Toolchain struct {
+	Assembler string // e.g. "as"
+	Compiler  string // the C compiler used to build the runtime and link, e.g. "cc"
+}
+
+// Default returns the toolchain given by $AS and $CC, falling back to `as`
+// and `cc`
+func Default() Toolchain {
+	tc := Toolchain{Assembler: "as", Compiler: "cc"}
+	if as := os.Getenv("AS"); as != "" {
+		tc.Assembler = as
+	}
+	if cc := os.Getenv("CC"); cc != "" {
+		tc.Compiler = cc
+	}
+	return tc
+}
+
+// Assemble assembles the file source into the object file object
+func (tc Toolchain) Assemble(source string, object string) error {
+	return run("assembler", "-as or $AS", tc.Assembler, "-o", object, source)
+}
+
+// Link links the object files with the runtime into the executable output
+func (tc Toolchain) Link(output string, objects ...string) error {
+	dir, err := ioutil.TempDir("", "bee")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	runtime := filepath.Join(dir, "runtime.c")
+	if err := ioutil.WriteFile(runtime, []byte(RuntimeSource), 0644); err != nil {
+		return err
+	}
+
+	args := append([]string{"-o", output}, objects...)
+	args = append(args, runtime)
+	return run("C compiler", "-cc or $CC", tc.Compiler, args...)
+}
+
+// Compile compiles the C source, which includes the runtime, into the
+// executable output
+func (tc Toolchain) Compile(output string, source string) error {
+	return run("C compiler", "-cc or $CC", tc.Compiler, "-o", output, source)
+}
+
+// CompileObject compiles the C source into the object file object
+func (tc Toolchain) CompileObject(source string, object string) error {
+	return run("C compiler", "-cc or $CC", tc.Compiler, "-c", "-o", object, source)
+}
+
+// run runs the command of the tool and includes its output in the error if
+// it fails. hint tells how to choose another command.
+func run(tool string, hint string, command string, args ...string) error {
+	// the command may contain flags, e.g. "gcc -m64"
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return fmt.Errorf("no %s is given (set %s)", tool, hint)
+	}
+
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		return fmt.Errorf("%s %q is not found (set %s)", tool, fields[0], hint)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(path, append(fields[1:], args...)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %s: %s\n%s", tool, strings.Join(cmd.Args, " "), err, out.String())
+	}
+
+	return nil
+}
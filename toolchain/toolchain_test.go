@@ -0,0 +1,45 @@
+package toolchain
+
+import (
+	"testing"
+)
+
+func TestSymbol(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"main", "bee_main"},
+		{"rt_div", "bee_rt__div"},
+		{"_x", "bee___x"},
+		{"été", "bee__u00e9_t_u00e9_"},
+	}
+
+	for i, tt := range tests {
+		if symbol := Symbol(tt.name); symbol != tt.expected {
+			t.Errorf("[test-%d] wrong symbol. expected=%q, got=%q", i, tt.expected, symbol)
+		}
+	}
+}
+
+func TestMissingTools(t *testing.T) {
+	tc := Toolchain{Assembler: "bee-missing-as", Compiler: ""}
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{tc.Assemble("a.s", "a.o"), `assembler "bee-missing-as" is not found (set -as or $AS)`},
+		{tc.Link("a.out", "a.o"), "no C compiler is given (set -cc or $CC)"},
+	}
+
+	for i, tt := range tests {
+		if tt.err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.expected)
+			continue
+		}
+		if tt.err.Error() != tt.expected {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.expected, tt.err.Error())
+		}
+	}
+}
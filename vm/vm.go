@@ -0,0 +1,266 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+)
+
+// maxCallDepth limits the depth of nested calls to detect runaway recursion
+const maxCallDepth = 10000
+
+// VM represents a virtual machine which executes IR directly
+type VM struct {
+	program   *ir.Program
+	functions map[string]*ir.Function
+	args      []string
+	in        *bufio.Scanner
+	eof       bool // set when GETS has reached the end of input
+	out       io.Writer
+	stack     []int64 // memory for local variables of all active frames
+	depth     int
+}
+
+// frame holds the state of a single function activation
+type frame struct {
+	function  *ir.Function
+	registers map[int]int64
+	slots     map[*ast.Variable]int
+	base      int
+	arguments []int64
+}
+
+// New returns a new VM which passes args to the program as command-line
+// arguments, reads the input of `gets` from in and writes the output of
+// `puts` to out
+func New(program *ir.Program, args []string, in io.Reader, out io.Writer) *VM {
+	scanner := bufio.NewScanner(in)
+	scanner.Split(bufio.ScanWords)
+
+	vm := &VM{
+		program:   program,
+		functions: make(map[string]*ir.Function),
+		args:      args,
+		in:        scanner,
+		out:       out,
+		stack:     []int64{},
+	}
+
+	for _, function := range program.Functions {
+		vm.functions[function.Node.Name] = function
+	}
+
+	return vm
+}
+
+// Run executes `main` and returns its return value
+func (vm *VM) Run() (int64, error) {
+	return vm.call("main", []int64{})
+}
+
+func (vm *VM) call(name string, arguments []int64) (int64, error) {
+	function, ok := vm.functions[name]
+	if !ok {
+		return 0, fmt.Errorf("function '%s' is not defined", name)
+	}
+
+	if vm.depth >= maxCallDepth {
+		return 0, fmt.Errorf("stack overflow in function '%s'", name)
+	}
+
+	f := &frame{
+		function:  function,
+		registers: make(map[int]int64),
+		slots:     make(map[*ast.Variable]int),
+		base:      len(vm.stack),
+		arguments: arguments,
+	}
+
+	for i, variable := range function.Node.Variables {
+		f.slots[variable] = i
+		vm.stack = append(vm.stack, 0)
+	}
+
+	vm.depth++
+	value, err := vm.execute(f)
+	vm.depth--
+
+	vm.stack = vm.stack[:f.base]
+
+	return value, err
+}
+
+func (vm *VM) execute(f *frame) (int64, error) {
+	blocks := f.function.BasicBlocks
+
+	index := make(map[*ir.BasicBlock]int)
+	for i, basicBlock := range blocks {
+		index[basicBlock] = i
+	}
+
+	current := 0
+
+	for current < len(blocks) {
+		next := current + 1
+
+	block:
+		for _, instr := range blocks[current].Irs {
+			switch instr := instr.(type) {
+			case *ir.ImmIr:
+				f.registers[instr.R.VirtualNo] = instr.Value
+			case *ir.MovIr:
+				f.registers[instr.R0.VirtualNo] = f.registers[instr.R1.VirtualNo]
+			case *ir.BinaryOpIr:
+				value, err := ir.EvalBinary(instr.Operator,
+					f.registers[instr.R1.VirtualNo],
+					f.registers[instr.R2.VirtualNo])
+				if err != nil {
+					return 0, err
+				}
+				f.registers[instr.R0.VirtualNo] = value
+			case *ir.UnaryOpIr:
+				value, err := ir.EvalUnary(instr.Operator, f.registers[instr.R1.VirtualNo])
+				if err != nil {
+					return 0, err
+				}
+				f.registers[instr.R0.VirtualNo] = value
+			case *ir.BprelIr:
+				slot, ok := f.slots[instr.Var]
+				if !ok {
+					return 0, fmt.Errorf("variable '%s' has no slot in function '%s'",
+						instr.Var.Name, f.function.Node.Name)
+				}
+				f.registers[instr.R.VirtualNo] = int64(f.base + slot)
+			case *ir.LoadIr:
+				address := f.registers[instr.R1.VirtualNo]
+				if err := vm.checkAddress(address); err != nil {
+					return 0, err
+				}
+				f.registers[instr.R0.VirtualNo] = vm.stack[address]
+			case *ir.StoreIr:
+				address := f.registers[instr.R0.VirtualNo]
+				if err := vm.checkAddress(address); err != nil {
+					return 0, err
+				}
+				vm.stack[address] = f.registers[instr.R1.VirtualNo]
+			case *ir.StoreArgIr:
+				if instr.Index >= len(f.arguments) {
+					return 0, fmt.Errorf("missing argument %d for function '%s'",
+						instr.Index, f.function.Node.Name)
+				}
+				slot, ok := f.slots[instr.Var]
+				if !ok {
+					return 0, fmt.Errorf("variable '%s' has no slot in function '%s'",
+						instr.Var.Name, f.function.Node.Name)
+				}
+				vm.stack[f.base+slot] = f.arguments[instr.Index]
+			case *ir.CallIr:
+				arguments := []int64{}
+				for _, r := range instr.Arguments {
+					arguments = append(arguments, f.registers[r.VirtualNo])
+				}
+				value, err := vm.call(instr.Function, arguments)
+				if err != nil {
+					return 0, err
+				}
+				f.registers[instr.Return.VirtualNo] = value
+			case *ir.ArgcIr:
+				f.registers[instr.R.VirtualNo] = int64(len(vm.args))
+			case *ir.ArgIr:
+				value, err := vm.arg(f.registers[instr.R1.VirtualNo])
+				if err != nil {
+					return 0, err
+				}
+				f.registers[instr.R0.VirtualNo] = value
+			case *ir.GetsIr:
+				value, err := vm.gets()
+				if err != nil {
+					return 0, err
+				}
+				f.registers[instr.R.VirtualNo] = value
+			case *ir.EofIr:
+				f.registers[instr.R.VirtualNo] = boolToInt(vm.eof)
+			case *ir.PutsIr:
+				fmt.Fprintln(vm.out, f.registers[instr.R.VirtualNo])
+			case *ir.JmpIr:
+				target, ok := index[instr.Target]
+				if !ok {
+					return 0, fmt.Errorf("jump to unknown block .L%d", instr.Target.Label)
+				}
+				next = target
+				break block
+			case *ir.BrIr:
+				target := instr.Alternative
+				if f.registers[instr.R.VirtualNo] != 0 {
+					target = instr.Consequence
+				}
+				i, ok := index[target]
+				if !ok {
+					return 0, fmt.Errorf("branch to unknown block .L%d", target.Label)
+				}
+				next = i
+				break block
+			case *ir.RetIr:
+				return f.registers[instr.R.VirtualNo], nil
+			case *ir.NopIr:
+			default:
+				return 0, fmt.Errorf("unknown instruction: %s", instr.String())
+			}
+		}
+
+		current = next
+	}
+
+	// falling off the end of a function returns 0 like the generator does
+	return 0, nil
+}
+
+func (vm *VM) arg(index int64) (int64, error) {
+	if index < 0 || index >= int64(len(vm.args)) {
+		return 0, fmt.Errorf("argument index %d out of range", index)
+	}
+
+	value, err := strconv.ParseInt(vm.args[index], 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d (%q) is not an integer", index, vm.args[index])
+	}
+
+	return value, nil
+}
+
+// gets reads the next whitespace separated integer from the input.
+// At the end of input it returns 0 and sets the EOF flag.
+func (vm *VM) gets() (int64, error) {
+	if !vm.in.Scan() {
+		if err := vm.in.Err(); err != nil {
+			return 0, err
+		}
+		vm.eof = true
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(vm.in.Text(), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("input %q is not an integer", vm.in.Text())
+	}
+
+	return value, nil
+}
+
+func (vm *VM) checkAddress(address int64) error {
+	if address < 0 || address >= int64(len(vm.stack)) {
+		return fmt.Errorf("invalid memory access at address %d", address)
+	}
+	return nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
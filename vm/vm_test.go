@@ -0,0 +1,215 @@
+package vm_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/vm"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		output   string
+		exitCode int64
+	}{
+		{"fn main() {}", "", 0},
+		{"fn main() { return 42; }", "", 42},
+		{"fn main() { puts 1 + 2 * 3; }", "7\n", 0},
+		{"fn main() { x = 3; y = x * x; puts y; return y - 9; }", "9\n", 0},
+		{"fn main() { x = 1; if (x < 2) { puts 1; } else { puts 2; } }", "1\n", 0},
+		{"fn main() { x = 2; if (x < 1) { puts 1; } else { puts 2; } }", "2\n", 0},
+		{"fn main() { i = 0; while (i < 3) { puts i; i = i + 1; } return i; }", "0\n1\n2\n", 3},
+		{"fn main() { x = 10; x += 5; x -= 3; x *= 4; x /= 6; x++; x++; x--; return x; }", "", 9},
+		{"fn main() { i = 0; s = 0; while (i < 4) { s += i; i++; } return s; }", "", 6},
+		{"fn main() { puts 'a'; puts '\\n'; return 'é' - 'e'; }", "97\n10\n", 132},
+		{"fn main() { return add(3, 4); } fn add(x, y) { return x + y; }", "", 7},
+		{"fn main() { return fact(5); } fn fact(n) { if (n < 2) { return 1; } return n * fact(n - 1); }", "", 120},
+		{"fn main() { i = 0; while (i < 3) { puts sq(i) + abs(0 - i); i++; } return sq(sq(2)); } fn sq(x) { return x * x; } fn abs(x) { if (x < 0) { return 0 - x; } return x; }", "0\n2\n6\n", 16},
+		{"fn main() { puts f(2); puts f(3); } fn f(x) { if (x == 2) { y = x; } return y; }", "2\n0\n", 0},
+		{"fn main() { return gcd(1071, 462); } fn gcd(a, b) { if (b == 0) { return a; } return gcd(b, a % b); }", "", 21},
+		{"fn main() { return f(3); } fn f(n) { if (n == 2) { y = 5; } if (n == 0) { return y; } return f(n - 1); }", "", 0},
+		{"fn main() { return even(10); } fn even(n) { if (n == 0) { return 1; } return odd(n - 1); } fn odd(n) { if (n == 0) { return 0; } return even(n - 1); }", "", 1},
+		{"fn main() { x = 7; y = 3; puts x % y; puts x & y; puts x | 8; puts x ^ y; puts ~x; puts x << y; puts 0 - x >> 1; }", "1\n3\n15\n4\n-8\n56\n-4\n", 0},
+		{"fn main() { puts 7 % 3; puts 6 & 3; puts 6 | 3; puts 6 ^ 3; puts ~5; puts !5; puts !0; puts 1 << 4; puts 64 >> 2; }", "1\n2\n7\n5\n-6\n0\n1\n16\n16\n", 0},
+		{"fn main() { x = 0; y = 5; puts !x; puts !y; puts x == x; puts x && y; puts x || y; }", "1\n0\n1\n0\n1\n", 0},
+		{"fn main() { x = 0 - 7; puts x / 4; puts x % 4; puts x * 8; puts 0 + x * 1; puts !!x && 1; if (!!!x) { return 1; } }", "-1\n-3\n-56\n-7\n1\n", 0},
+		{"fn main() { puts 1 < 2; puts 2 == 2; puts 2 && 3; puts 0 || 0; if (1 < 2) { return 9223372036854775807 + 1 == 0 - 9223372036854775807 - 1; } }", "1\n1\n1\n0\n", 1},
+	}
+
+	for i, tt := range tests {
+		// every optimization level must preserve the behavior
+		for level := 0; level <= 2; level++ {
+			var out bytes.Buffer
+
+			exitCode, err := vm.New(testutil.Compile(t, tt.input, level), []string{}, strings.NewReader(""), &out).Run()
+			if err != nil {
+				t.Errorf("[test-%d] -O%d: unexpected error: %s", i, level, err)
+				continue
+			}
+
+			if out.String() != tt.output {
+				t.Errorf("[test-%d] -O%d: wrong output. expected=%q, got=%q", i, level, tt.output, out.String())
+			}
+
+			if exitCode != tt.exitCode {
+				t.Errorf("[test-%d] -O%d: wrong exit code. expected=%d, got=%d", i, level, tt.exitCode, exitCode)
+			}
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"fn main() { x = 0; return 1 / x; }", "division by zero"},
+		{"fn main() { x = 0; return 1 % x; }", "division by zero"},
+		{"fn main() { return 1 / 0; }", "division by zero"},
+		{"fn main() { puts 7 % 0; }", "division by zero"},
+		{"fn main() { return main() + 1; }", "stack overflow in function 'main'"},
+		{"fn main() { return arg(0); }", "argument index 0 out of range"},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+
+		_, err := vm.New(testutil.Compile(t, tt.input, 1), []string{}, strings.NewReader(""), &out).Run()
+		if err == nil {
+			t.Errorf("[test-%d] expected error %q, got nothing", i, tt.err)
+			continue
+		}
+
+		if err.Error() != tt.err {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.err, err.Error())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	input := "fn main() { return count(100000, 0); } fn count(n, acc) { if (n == 0) { return acc % 256; } return count(n - 1, acc + 1); }"
+
+	// without optimization the recursion is too deep
+	_, err := vm.New(testutil.Compile(t, input, 0), []string{}, strings.NewReader(""), &bytes.Buffer{}).Run()
+	if err == nil || err.Error() != "stack overflow in function 'count'" {
+		t.Errorf("expected stack overflow at -O0, got %v", err)
+	}
+
+	exitCode, err := vm.New(testutil.Compile(t, input, 1), []string{}, strings.NewReader(""), &bytes.Buffer{}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exitCode != 160 {
+		t.Errorf("wrong exit code. expected=%d, got=%d", 160, exitCode)
+	}
+}
+
+func TestArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		args     []string
+		output   string
+		exitCode int64
+	}{
+		{"fn main() { return argc(); }", []string{}, "", 0},
+		{"fn main() { return argc(); }", []string{"1", "2", "3"}, "", 3},
+		{"fn main() { i = 0; while (i < argc()) { puts arg(i); i = i + 1; } }", []string{"10", "-3", "0x10"}, "10\n-3\n16\n", 0},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+
+		exitCode, err := vm.New(testutil.Compile(t, tt.input, 1), tt.args, strings.NewReader(""), &out).Run()
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if out.String() != tt.output {
+			t.Errorf("[test-%d] wrong output. expected=%q, got=%q", i, tt.output, out.String())
+		}
+
+		if exitCode != tt.exitCode {
+			t.Errorf("[test-%d] wrong exit code. expected=%d, got=%d", i, tt.exitCode, exitCode)
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		output   string
+		exitCode int64
+	}{
+		{"fn main() { return eof(); }", "", "", 0},
+		{"fn main() { x = gets(); return eof(); }", "", "", 1},
+		{"fn main() { x = gets(); return eof(); }", "0", "", 0},
+		{"fn main() { return gets() + gets(); }", "3\n4\n", "", 7},
+		{
+			"fn main() { s = 0; x = gets(); while (!eof()) { s = s + x; puts s; x = gets(); } return s; }",
+			"1 2\n 3\n",
+			"1\n3\n6\n",
+			6,
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+
+		exitCode, err := vm.New(testutil.Compile(t, tt.input, 1), []string{}, strings.NewReader(tt.stdin), &out).Run()
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if out.String() != tt.output {
+			t.Errorf("[test-%d] wrong output. expected=%q, got=%q", i, tt.output, out.String())
+		}
+
+		if exitCode != tt.exitCode {
+			t.Errorf("[test-%d] wrong exit code. expected=%d, got=%d", i, tt.exitCode, exitCode)
+		}
+	}
+}
+
+func TestParsedIR(t *testing.T) {
+	tests := []string{
+		"fn main() { i = 0; s = 0; while (i < 4) { s += i; i++; } puts s; return s; }",
+		"fn main() { puts add(3, 4); return add(1, 2); } fn add(x, y) { return x + y; }",
+		"fn main() { if (argc() == 2) { puts arg(1) - arg(0); } return !argc(); }",
+	}
+
+	for i, tt := range tests {
+		compiled := testutil.Compile(t, tt, 1)
+
+		parsed, err := ir.Parse(compiled.String())
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if parsed.String() != compiled.String() {
+			t.Errorf("[test-%d] IR does not round-trip. expected=\n%s\ngot=\n%s",
+				i, compiled.String(), parsed.String())
+		}
+
+		var expected, actual bytes.Buffer
+		args := []string{"5", "8"}
+		expectedCode, _ := vm.New(compiled, args, strings.NewReader(""), &expected).Run()
+		actualCode, err := vm.New(parsed, args, strings.NewReader(""), &actual).Run()
+		if err != nil {
+			t.Errorf("[test-%d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if actual.String() != expected.String() || actualCode != expectedCode {
+			t.Errorf("[test-%d] wrong result. expected=(%q, %d), got=(%q, %d)",
+				i, expected.String(), expectedCode, actual.String(), actualCode)
+		}
+	}
+}
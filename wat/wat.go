@@ -0,0 +1,461 @@
+package wat
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/d2verb/bee/ast"
+	"github.com/d2verb/bee/ir"
+	"github.com/d2verb/bee/toolchain"
+)
+
+// Generator translates IR into a WebAssembly module in the text format.
+//
+// Every function takes and returns i64 values and the function named main
+// is exported as "main". Registers and variables become locals, so the
+// program needs no linear memory. The built-in functions are imported from
+// the host module "bee":
+//
+//	puts (i64)          prints the value followed by a newline
+//	gets () -> i64      reads the next integer, or returns 0 at the end of input
+//	eof () -> i64       returns 1 after gets reached the end of input
+//	argc () -> i64      returns the number of arguments
+//	arg (i64) -> i64    returns the argument at the index
+//	division_by_zero () reports the error and does not return
+//
+// WebAssembly has no goto, so the control flow of each function is
+// reconstructed with block, loop and if as described in "Beyond Relooper"
+// by Norman Ramsey. This requires a reducible control flow graph, which the
+// generator and the optimizer always produce.
+type Generator struct {
+	program *ir.Program
+	out     bytes.Buffer
+
+	// the state of the function being generated
+	dominators *ir.Dominators
+	order      map[*ir.BasicBlock]int
+	headers    map[*ir.BasicBlock]bool
+	merges     map[*ir.BasicBlock]bool
+	variables  map[*ast.Variable]string
+	addresses  map[*ir.Register]*ast.Variable
+	depth      int
+}
+
+// New returns a new generator for program
+func New(program *ir.Program) *Generator {
+	return &Generator{program: program}
+}
+
+// imports declares the built-in functions provided by the host
+var imports = []string{
+	`(import "bee" "puts" (func $bee_puts (param i64)))`,
+	`(import "bee" "gets" (func $bee_gets (result i64)))`,
+	`(import "bee" "eof" (func $bee_eof (result i64)))`,
+	`(import "bee" "argc" (func $bee_argc (result i64)))`,
+	`(import "bee" "arg" (func $bee_arg (param i64) (result i64)))`,
+	`(import "bee" "division_by_zero" (func $bee_division_by_zero))`,
+}
+
+// helpers divide like ir.EvalBinary. i64.div_s traps on zero and on
+// overflow, and i64.rem_s traps on zero.
+var helpers = []string{
+	`(func $bee_rt_div (param $a i64) (param $b i64) (result i64)`,
+	`  (if (i64.eqz (local.get $b))`,
+	`    (then (call $bee_division_by_zero) (unreachable)))`,
+	`  (if (result i64) (i64.eq (local.get $b) (i64.const -1))`,
+	`    (then (i64.sub (i64.const 0) (local.get $a)))`,
+	`    (else (i64.div_s (local.get $a) (local.get $b)))))`,
+	`(func $bee_rt_mod (param $a i64) (param $b i64) (result i64)`,
+	`  (if (i64.eqz (local.get $b))`,
+	`    (then (call $bee_division_by_zero) (unreachable)))`,
+	`  (i64.rem_s (local.get $a) (local.get $b)))`,
+}
+
+// Generate generates the module of the whole program. It fails if the
+// control flow of a function is irreducible or the address of a variable
+// is used other than by LOAD and STORE.
+func (g *Generator) Generate() (string, error) {
+	g.out.Reset()
+	g.depth = 0
+
+	g.emit("(module")
+	g.depth++
+	for _, line := range imports {
+		g.emit("%s", line)
+	}
+	for _, line := range helpers {
+		g.emit("%s", line)
+	}
+
+	for _, function := range g.program.Functions {
+		if err := g.generateFunction(function); err != nil {
+			return "", fmt.Errorf("function '%s': %s", function.Node.Name, err)
+		}
+		if function.Node.Name == "main" {
+			g.emit(`(export "main" (func $%s))`, toolchain.Symbol("main"))
+		}
+	}
+
+	g.depth--
+	g.emit(")")
+
+	return g.out.String(), nil
+}
+
+func (g *Generator) generateFunction(function *ir.Function) error {
+	ir.BuildCFG(function)
+	g.dominators = ir.ComputeDominators(function)
+	g.order = make(map[*ir.BasicBlock]int)
+	g.headers = make(map[*ir.BasicBlock]bool)
+	g.merges = make(map[*ir.BasicBlock]bool)
+	g.variables = make(map[*ast.Variable]string)
+
+	blocks := ir.ReversePostorder(function)
+	for i, bb := range blocks {
+		g.order[bb] = i
+	}
+
+	// a retreating edge must be a back edge to a loop header, and a block
+	// with several forward edges is placed after a block its predecessors
+	// break out of
+	for _, bb := range blocks {
+		if len(bb.Irs) == 0 || !ir.IsTerminator(bb.Irs[len(bb.Irs)-1]) {
+			return fmt.Errorf("basic block .L%d does not end with a terminator", bb.Label)
+		}
+
+		forward := 0
+		for _, pred := range bb.Preds {
+			if !g.dominators.Reachable(pred) {
+				continue
+			}
+			if g.order[pred] < g.order[bb] {
+				forward++
+			} else if g.dominators.Dominates(bb, pred) {
+				g.headers[bb] = true
+			} else {
+				return fmt.Errorf("irreducible control flow at .L%d", bb.Label)
+			}
+		}
+		if forward > 1 {
+			g.merges[bb] = true
+		}
+	}
+
+	if err := g.resolveAddresses(function); err != nil {
+		return err
+	}
+
+	symbol := toolchain.Symbol(function.Node.Name)
+	signature := "(func $" + symbol
+	for i := range function.Node.Parameters {
+		signature += fmt.Sprintf(" (param $p%d i64)", i)
+	}
+	g.emit("%s (result i64)", signature)
+	g.depth++
+
+	// locals start from zero like variables in the VM
+	for i, variable := range function.Node.Variables {
+		g.variables[variable] = fmt.Sprintf("$v%d", i)
+		g.emit("(local $v%d i64) ;; %s", i, variable.Name)
+	}
+
+	declared := make(map[*ir.Register]bool)
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			rs := ir.Uses(instr)
+			if r := ir.Def(instr); r != nil {
+				rs = append(rs, r)
+			}
+			for _, r := range rs {
+				if _, ok := g.addresses[r]; !ok && !declared[r] {
+					declared[r] = true
+					g.emit("(local $%s i64)", r)
+				}
+			}
+		}
+	}
+
+	if len(blocks) > 0 {
+		g.generateTree(blocks[0])
+	}
+
+	// every path returns explicitly, but the body must end with a result
+	g.emit("i64.const 0")
+	g.depth--
+	g.emit(")")
+
+	return nil
+}
+
+// resolveAddresses finds the variable held by each register defined by
+// BPREL or copied from one. Such registers only live at compile time, as
+// LOAD and STORE through them become local.get and local.set.
+func (g *Generator) resolveAddresses(function *ir.Function) error {
+	g.addresses = make(map[*ir.Register]*ast.Variable)
+
+	for changed := true; changed; {
+		changed = false
+		for _, bb := range function.BasicBlocks {
+			for _, instr := range bb.Irs {
+				switch instr := instr.(type) {
+				case *ir.BprelIr:
+					if _, ok := g.addresses[instr.R]; !ok {
+						g.addresses[instr.R] = instr.Var
+						changed = true
+					}
+				case *ir.MovIr:
+					variable, ok := g.addresses[instr.R1]
+					if _, done := g.addresses[instr.R0]; ok && !done {
+						g.addresses[instr.R0] = variable
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, bb := range function.BasicBlocks {
+		for _, instr := range bb.Irs {
+			var uses []*ir.Register
+			switch instr := instr.(type) {
+			case *ir.LoadIr:
+				if _, ok := g.addresses[instr.R1]; !ok {
+					return fmt.Errorf("'%s' does not load a variable", instr)
+				}
+			case *ir.StoreIr:
+				if _, ok := g.addresses[instr.R0]; !ok {
+					return fmt.Errorf("'%s' does not store to a variable", instr)
+				}
+				uses = []*ir.Register{instr.R1}
+			case *ir.MovIr:
+			default:
+				uses = ir.Uses(instr)
+			}
+
+			for _, r := range uses {
+				if variable, ok := g.addresses[r]; ok {
+					return fmt.Errorf("'%s' uses the address of variable '%s'", instr, variable.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// generateTree generates bb and the blocks it immediately dominates. A loop
+// header is wrapped in a loop, so that back edges continue it.
+func (g *Generator) generateTree(bb *ir.BasicBlock) {
+	merges := []*ir.BasicBlock{}
+	for _, child := range g.dominators.Children(bb) {
+		if g.merges[child] {
+			merges = append(merges, child)
+		}
+	}
+	// the merge block placed last is the outermost one
+	sort.Slice(merges, func(i, j int) bool {
+		return g.order[merges[i]] > g.order[merges[j]]
+	})
+
+	if g.headers[bb] {
+		g.emit("loop $%s", loopLabel(bb))
+		g.depth++
+		g.generateWithin(bb, merges)
+		g.depth--
+		g.emit("end")
+	} else {
+		g.generateWithin(bb, merges)
+	}
+}
+
+// generateWithin generates bb inside a block for each of the merge blocks,
+// which follow their blocks so that a branch to them breaks out of it
+func (g *Generator) generateWithin(bb *ir.BasicBlock, merges []*ir.BasicBlock) {
+	if len(merges) == 0 {
+		g.emit(";; .L%d", bb.Label)
+		for _, instr := range bb.Irs {
+			g.generateInstruction(bb, instr)
+		}
+		return
+	}
+
+	g.emit("block $%s", blockLabel(merges[0]))
+	g.depth++
+	g.generateWithin(bb, merges[1:])
+	g.depth--
+	g.emit("end")
+	g.generateTree(merges[0])
+}
+
+// generateBranch transfers control from the block from to the block to
+func (g *Generator) generateBranch(from *ir.BasicBlock, to *ir.BasicBlock) {
+	switch {
+	case g.order[to] <= g.order[from]:
+		g.emit("br $%s", loopLabel(to))
+	case g.merges[to]:
+		g.emit("br $%s", blockLabel(to))
+	default:
+		// from is the only predecessor, so to is placed right here
+		g.generateTree(to)
+	}
+}
+
+func (g *Generator) generateInstruction(bb *ir.BasicBlock, instr ir.Ir) {
+	switch instr := instr.(type) {
+	case *ir.ImmIr:
+		g.emit("i64.const %d", instr.Value)
+		g.set(instr.R)
+	case *ir.MovIr:
+		if _, ok := g.addresses[instr.R0]; !ok {
+			g.get(instr.R1)
+			g.set(instr.R0)
+		}
+	case *ir.BinaryOpIr:
+		g.binary(instr.Operator, instr.R1, instr.R2)
+		g.set(instr.R0)
+	case *ir.UnaryOpIr:
+		g.get(instr.R1)
+		switch instr.Operator {
+		case "!":
+			g.emit("i64.eqz")
+			g.emit("i64.extend_i32_u")
+		case "~":
+			g.emit("i64.const -1")
+			g.emit("i64.xor")
+		}
+		g.set(instr.R0)
+	case *ir.BprelIr:
+		// resolved by LOAD and STORE
+	case *ir.LoadIr:
+		g.emit("local.get %s", g.variables[g.addresses[instr.R1]])
+		g.set(instr.R0)
+	case *ir.StoreIr:
+		g.get(instr.R1)
+		g.emit("local.set %s", g.variables[g.addresses[instr.R0]])
+	case *ir.StoreArgIr:
+		g.emit("local.get $p%d", instr.Index)
+		g.emit("local.set %s", g.variables[instr.Var])
+	case *ir.CallIr:
+		for _, r := range instr.Arguments {
+			g.get(r)
+		}
+		g.emit("call $%s", toolchain.Symbol(instr.Function))
+		g.set(instr.Return)
+	case *ir.ArgcIr:
+		g.emit("call $bee_argc")
+		g.set(instr.R)
+	case *ir.ArgIr:
+		g.get(instr.R1)
+		g.emit("call $bee_arg")
+		g.set(instr.R0)
+	case *ir.GetsIr:
+		g.emit("call $bee_gets")
+		g.set(instr.R)
+	case *ir.EofIr:
+		g.emit("call $bee_eof")
+		g.set(instr.R)
+	case *ir.PutsIr:
+		g.get(instr.R)
+		g.emit("call $bee_puts")
+	case *ir.JmpIr:
+		g.generateBranch(bb, instr.Target)
+	case *ir.BrIr:
+		if instr.Consequence == instr.Alternative {
+			g.generateBranch(bb, instr.Consequence)
+			return
+		}
+		g.get(instr.R)
+		g.emit("i64.eqz")
+		g.emit("if")
+		g.depth++
+		g.generateBranch(bb, instr.Alternative)
+		g.depth--
+		g.emit("else")
+		g.depth++
+		g.generateBranch(bb, instr.Consequence)
+		g.depth--
+		g.emit("end")
+	case *ir.RetIr:
+		g.get(instr.R)
+		g.emit("return")
+	case *ir.NopIr:
+	}
+}
+
+// binary pushes `a op b` computed like ir.EvalBinary. Shift counts are
+// masked to 6 bits by WebAssembly.
+func (g *Generator) binary(op string, a *ir.Register, b *ir.Register) {
+	if op == "&&" {
+		g.get(a)
+		g.emit("i64.const 0")
+		g.emit("i64.ne")
+		g.get(b)
+		g.emit("i64.const 0")
+		g.emit("i64.ne")
+		g.emit("i32.and")
+		g.emit("i64.extend_i32_u")
+		return
+	}
+
+	g.get(a)
+	g.get(b)
+	switch op {
+	case "+":
+		g.emit("i64.add")
+	case "-":
+		g.emit("i64.sub")
+	case "*":
+		g.emit("i64.mul")
+	case "&":
+		g.emit("i64.and")
+	case "|":
+		g.emit("i64.or")
+	case "^":
+		g.emit("i64.xor")
+	case "<<":
+		g.emit("i64.shl")
+	case ">>":
+		g.emit("i64.shr_s")
+	case "==":
+		g.emit("i64.eq")
+		g.emit("i64.extend_i32_u")
+	case "<":
+		g.emit("i64.lt_s")
+		g.emit("i64.extend_i32_u")
+	case "||":
+		g.emit("i64.or")
+		g.emit("i64.const 0")
+		g.emit("i64.ne")
+		g.emit("i64.extend_i32_u")
+	case "/":
+		g.emit("call $bee_rt_div")
+	case "%":
+		g.emit("call $bee_rt_mod")
+	}
+}
+
+func (g *Generator) get(r *ir.Register) {
+	g.emit("local.get $%s", r)
+}
+
+func (g *Generator) set(r *ir.Register) {
+	g.emit("local.set $%s", r)
+}
+
+// blockLabel returns the label of the block which bb follows
+func blockLabel(bb *ir.BasicBlock) string {
+	return fmt.Sprintf("B%d", bb.Label)
+}
+
+// loopLabel returns the label of the loop headed by bb
+func loopLabel(bb *ir.BasicBlock) string {
+	return fmt.Sprintf("L%d", bb.Label)
+}
+
+func (g *Generator) emit(format string, a ...interface{}) {
+	g.out.WriteString(strings.Repeat("  ", g.depth))
+	g.out.WriteString(fmt.Sprintf(format, a...))
+	g.out.WriteString("\n")
+}
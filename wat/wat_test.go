@@ -0,0 +1,172 @@
+package wat
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/d2verb/bee/internal/testutil"
+	"github.com/d2verb/bee/ir"
+)
+
+func TestGenerate(t *testing.T) {
+	program, err := ir.Parse("[main]\n.L0:\n  ARGC r0\n  JMP .L1\n.L1:\n  IMM r1, -9223372036854775808\n  r2 = r0 + r1\n" +
+		"  BR r2, .L2, .L3\n.L2:\n  PUTS r2\n  JMP .L1\n.L3:\n  CALL r3, f(r0, r2)\n  RET r3\n" +
+		"[f]\n.L0:\n  STORE_ARG 0 a\n  STORE_ARG 1 b\n  BPREL r0, a\n  MOV r1, r0\n  LOAD r2, [r1]\n  r3 = r2 / r2\n  STORE [r0], r3\n  RET r2\n")
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	module, err := New(program).Generate()
+	if err != nil {
+		t.Fatalf("generate error: %s", err)
+	}
+
+	expected := []string{
+		"(func $bee_main (result i64)\n    (local $r0 i64)\n    (local $r1 i64)\n    (local $r2 i64)\n    (local $r3 i64)\n" +
+			"    ;; .L0\n    call $bee_argc\n    local.set $r0\n" +
+			"    loop $L1\n      ;; .L1\n      i64.const -9223372036854775808\n      local.set $r1\n" +
+			"      local.get $r0\n      local.get $r1\n      i64.add\n      local.set $r2\n" +
+			"      local.get $r2\n      i64.eqz\n      if\n        ;; .L3\n" +
+			"        local.get $r0\n        local.get $r2\n        call $bee_f\n        local.set $r3\n        local.get $r3\n        return\n" +
+			"      else\n        ;; .L2\n        local.get $r2\n        call $bee_puts\n        br $L1\n      end\n    end\n    i64.const 0\n  )\n" +
+			"  (export \"main\" (func $bee_main))\n",
+		"(func $bee_f (param $p0 i64) (param $p1 i64) (result i64)\n    (local $v0 i64) ;; a\n    (local $v1 i64) ;; b\n" +
+			"    (local $r2 i64)\n    (local $r3 i64)\n" +
+			"    ;; .L0\n    local.get $p0\n    local.set $v0\n    local.get $p1\n    local.set $v1\n" +
+			"    local.get $v0\n    local.set $r2\n    local.get $r2\n    local.get $r2\n    call $bee_rt_div\n    local.set $r3\n" +
+			"    local.get $r3\n    local.set $v0\n    local.get $r2\n    return\n",
+	}
+	for i, e := range expected {
+		if !strings.Contains(module, e) {
+			t.Errorf("[test-%d] %q is missing in\n%s", i, e, module)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"[main]\n.L0:\n  ARGC r0\n  BR r0, .L1, .L2\n.L1:\n  JMP .L2\n.L2:\n  JMP .L1\n",
+			"function 'main': irreducible control flow at .L1",
+		},
+		{
+			"[main]\n.L0:\n  BPREL r0, x\n  PUTS r0\n  RET r0\n",
+			"function 'main': 'PUTS r0' uses the address of variable 'x'",
+		},
+		{
+			"[main]\n.L0:\n  IMM r0, 8\n  LOAD r1, [r0]\n  RET r1\n",
+			"function 'main': 'LOAD r1, [r0]' does not load a variable",
+		},
+	}
+
+	for i, tt := range tests {
+		program, err := ir.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("[test-%d] parse error: %s", i, err)
+		}
+
+		_, err = New(program).Generate()
+		if err == nil {
+			t.Errorf("[test-%d] no error", i)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("[test-%d] wrong error. expected=%q, got=%q", i, tt.expected, err.Error())
+		}
+	}
+}
+
+// TestStructure checks that the control flow of compiled programs is well
+// nested, that branches only target enclosing labels and that every local
+// and function is declared
+func TestStructure(t *testing.T) {
+	tests := []string{
+		"fn main() { return 42; }",
+		"fn main() { x = 7; y = 3; puts x / y; puts x % y; puts x && y; puts !x || ~y; }",
+		"fn main() { i = 0; s = 0; while (i < 10) { if (i % 2 == 0) { s += i; } else { s -= 1; } i++; } return s; }",
+		"fn main() { i = 0; while (i < 3) { j = 0; while (j < i) { if (j == 1) { puts j; } j++; } i++; } return i; }",
+		"fn main() { x = gets(); if (x < 0) { return 0 - x; } if (x == 0) { puts 0; } return x; }",
+		"fn main() { return fact(10) % 256; } fn fact(n) { if (n < 2) { return 1; } return n * fact(n - 1); }",
+		"fn main() { s = 0; x = gets(); while (!eof()) { s = s + x; x = gets(); } return s; }",
+		"fn main() { puts argc(); puts arg(0) + sum(1, 2, 3); } fn sum(a, b, c) { return a + b + c; }",
+	}
+
+	functions := regexp.MustCompile(`\(func \$(\S+)`)
+	locals := regexp.MustCompile(`\((?:local|param) \$(\S+) i64\)`)
+
+	for i, input := range tests {
+		for level := 0; level <= 2; level++ {
+			module, err := New(testutil.Compile(t, input, level)).Generate()
+			if err != nil {
+				t.Fatalf("[test-%d] -O%d: generate error: %s", i, level, err)
+			}
+
+			defined := make(map[string]bool)
+			for _, match := range functions.FindAllStringSubmatch(module, -1) {
+				defined[match[1]] = true
+			}
+
+			var declared map[string]bool
+			var labels []string
+			for _, line := range strings.Split(module, "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					continue
+				}
+
+				switch fields[0] {
+				case "(func":
+					declared = make(map[string]bool)
+					for _, match := range locals.FindAllStringSubmatch(line, -1) {
+						declared[match[1]] = true
+					}
+				case "(local":
+					for _, match := range locals.FindAllStringSubmatch(line, -1) {
+						declared[match[1]] = true
+					}
+				case "block", "loop":
+					labels = append(labels, fields[1])
+				case "if":
+					labels = append(labels, "")
+				case "else":
+					if len(labels) == 0 || labels[len(labels)-1] != "" {
+						t.Errorf("[test-%d] -O%d: else without if", i, level)
+					}
+				case "end":
+					if len(labels) == 0 {
+						t.Errorf("[test-%d] -O%d: unbalanced end", i, level)
+						continue
+					}
+					labels = labels[:len(labels)-1]
+				case "br":
+					found := false
+					for _, label := range labels {
+						found = found || label == fields[1]
+					}
+					if !found {
+						t.Errorf("[test-%d] -O%d: %s is not an enclosing label", i, level, fields[1])
+					}
+				case "local.get", "local.set":
+					if !declared[strings.TrimPrefix(fields[1], "$")] {
+						t.Errorf("[test-%d] -O%d: %s is not declared", i, level, fields[1])
+					}
+				case "call":
+					if !defined[strings.TrimPrefix(fields[1], "$")] {
+						t.Errorf("[test-%d] -O%d: %s is not defined", i, level, fields[1])
+					}
+				}
+			}
+
+			if len(labels) != 0 {
+				t.Errorf("[test-%d] -O%d: %d blocks are not closed", i, level, len(labels))
+			}
+			if !strings.Contains(module, `(export "main" (func $bee_main))`) {
+				t.Errorf("[test-%d] -O%d: main is not exported", i, level)
+			}
+		}
+	}
+}